@@ -0,0 +1,182 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// AccessTracker is implemented by the providers built WithAccessTracking.
+type AccessTracker interface {
+	// AccessTimes returns the time each tracked key was last read or written, keyed by the store name and the
+	// key joined with "/".
+	AccessTimes() map[string]time.Time
+}
+
+// WithAccessTracking records when each key was last read with Get or GetBulk, or written with Put or Batch,
+// on the clock given with WithClock, to feed eviction logic kept outside the provider. Deleted keys are
+// forgotten, and only the maxKeys most recently accessed keys are kept so that memory stays bounded. The
+// provider returned by BuildProvider then implements AccessTracker. A maxKeys of zero or less disables the
+// tracking.
+func WithAccessTracking(maxKeys int) BuildOption {
+	return func(opts *buildOptions) {
+		if maxKeys <= 0 {
+			return
+		}
+
+		tracker := &accessTracker{maxKeys: maxKeys, order: list.New(), entries: map[string]*list.Element{}}
+		opts.access = tracker
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(name string, s storage.Store) storage.Store {
+				return &accessTrackingStore{Store: s, name: name, tracker: tracker, clock: opts.clock}
+			})
+		})
+	}
+}
+
+// accessTracker keeps the last access times of up to maxKeys keys, most recent first in order.
+type accessTracker struct {
+	mutex   sync.Mutex
+	maxKeys int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type accessEntry struct {
+	id string
+	at time.Time
+}
+
+func (t *accessTracker) touch(id string, at time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if element, ok := t.entries[id]; ok {
+		element.Value.(*accessEntry).at = at
+		t.order.MoveToFront(element)
+
+		return
+	}
+
+	t.entries[id] = t.order.PushFront(&accessEntry{id: id, at: at})
+
+	if t.order.Len() > t.maxKeys {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.entries, oldest.Value.(*accessEntry).id)
+	}
+}
+
+func (t *accessTracker) forget(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if element, ok := t.entries[id]; ok {
+		t.order.Remove(element)
+		delete(t.entries, id)
+	}
+}
+
+func (t *accessTracker) AccessTimes() map[string]time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	times := make(map[string]time.Time, len(t.entries))
+
+	for id, element := range t.entries {
+		times[id] = element.Value.(*accessEntry).at
+	}
+
+	return times
+}
+
+type accessTrackingStore struct {
+	storage.Store
+	name    string
+	tracker *accessTracker
+	clock   Clock
+}
+
+func (s *accessTrackingStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if err := s.Store.Put(key, value, tags...); err != nil {
+		return err
+	}
+
+	s.touch(key)
+
+	return nil
+}
+
+func (s *accessTrackingStore) Get(key string) ([]byte, error) {
+	value, err := s.Store.Get(key)
+	if err == nil {
+		s.touch(key)
+	}
+
+	return value, err
+}
+
+func (s *accessTrackingStore) GetBulk(keys ...string) ([][]byte, error) {
+	values, err := s.Store.GetBulk(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		if i < len(values) && values[i] != nil {
+			s.touch(key)
+		}
+	}
+
+	return values, nil
+}
+
+func (s *accessTrackingStore) Delete(key string) error {
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+
+	s.tracker.forget(s.name + "/" + key)
+
+	return nil
+}
+
+func (s *accessTrackingStore) Batch(operations []storage.Operation) error {
+	if err := s.Store.Batch(operations); err != nil {
+		return err
+	}
+
+	for _, op := range operations {
+		if op.Value == nil {
+			s.tracker.forget(s.name + "/" + op.Key)
+		} else {
+			s.touch(op.Key)
+		}
+	}
+
+	return nil
+}
+
+func (s *accessTrackingStore) touch(key string) {
+	s.tracker.touch(s.name+"/"+key, s.clock.Now())
+}
+
+type accessTrackingProvider struct {
+	*builtProvider
+	*accessTracker
+}
+
+type historyAccessTrackingProvider struct {
+	*builtProvider
+	*operationHistory
+	*accessTracker
+}
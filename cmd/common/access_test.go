@@ -0,0 +1,135 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAccessTracking(t *testing.T) {
+	setup := func(t *testing.T, maxKeys int) (storage.Store, AccessTracker, *manualClock) {
+		t.Helper()
+
+		clock := &manualClock{}
+
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithClock(clock), WithAccessTracking(maxKeys))
+		require.NoError(t, err)
+
+		tracker, ok := p.(AccessTracker)
+		require.True(t, ok)
+
+		s, err := p.OpenStore("cache")
+		require.NoError(t, err)
+
+		return s, tracker, clock
+	}
+
+	t.Run("updates on put and get", func(t *testing.T) {
+		s, tracker, clock := setup(t, 10)
+		start := clock.Now()
+
+		require.NoError(t, s.Put("a", []byte("1")))
+		clock.advance(time.Minute)
+		require.NoError(t, s.Put("b", []byte("2")))
+		require.Equal(t, map[string]time.Time{"cache/a": start, "cache/b": start.Add(time.Minute)},
+			tracker.AccessTimes())
+
+		clock.advance(time.Minute)
+		_, err := s.Get("a")
+		require.NoError(t, err)
+
+		_, err = s.Get("missing")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+		require.Equal(t, map[string]time.Time{
+			"cache/a": start.Add(2 * time.Minute), "cache/b": start.Add(time.Minute),
+		}, tracker.AccessTimes())
+	})
+
+	t.Run("bulk operations and deletes", func(t *testing.T) {
+		s, tracker, clock := setup(t, 10)
+		start := clock.Now()
+
+		require.NoError(t, s.Batch([]storage.Operation{
+			{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")},
+		}))
+
+		clock.advance(time.Minute)
+		_, err := s.GetBulk("b", "missing")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Delete("a"))
+		require.Equal(t, map[string]time.Time{"cache/b": start.Add(time.Minute)}, tracker.AccessTimes())
+
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "b"}}))
+		require.Empty(t, tracker.AccessTimes())
+	})
+
+	t.Run("keeps the most recently accessed keys", func(t *testing.T) {
+		s, tracker, _ := setup(t, 2)
+
+		require.NoError(t, s.Put("a", []byte("1")))
+		require.NoError(t, s.Put("b", []byte("2")))
+
+		_, err := s.Get("a")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("c", []byte("3")))
+
+		times := tracker.AccessTimes()
+		require.Len(t, times, 2)
+		require.Contains(t, times, "cache/a")
+		require.Contains(t, times, "cache/c")
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		s, tracker, _ := setup(t, 5)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				require.NoError(t, s.Put(strconv.Itoa(i), []byte("v")))
+				tracker.AccessTimes()
+			}(i)
+		}
+
+		wg.Wait()
+		require.Len(t, tracker.AccessTimes(), 5)
+	})
+
+	t.Run("combined with the history", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger,
+			WithAccessTracking(1), WithOperationHistory(1))
+		require.NoError(t, err)
+
+		_, ok := p.(AccessTracker)
+		require.True(t, ok)
+
+		_, ok = p.(HistoryReporter)
+		require.True(t, ok)
+		require.NoError(t, OnClose(p, func() error { return nil }))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithAccessTracking(0))
+		require.NoError(t, err)
+
+		_, ok := p.(AccessTracker)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,145 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// ErrBatchNotAtomic is returned by AtomicBatch for providers whose batches are not applied atomically.
+var ErrBatchNotAtomic = errors.New("storage provider does not apply batches atomically")
+
+// BatchSupporter is implemented by providers that report whether the Batch of their stores is atomic. The
+// providers returned by BuildProvider implement it from the Transactions capability of their driver.
+type BatchSupporter interface {
+	SupportsBatch() bool
+}
+
+// SupportsBatch reports whether the Batch of the stores of p is applied atomically, so that callers can use it
+// where available and fall back to individual operations otherwise. Providers that don't implement
+// BatchSupporter are assumed not to.
+func SupportsBatch(p storage.Provider) bool {
+	supporter, ok := p.(BatchSupporter)
+
+	return ok && supporter.SupportsBatch()
+}
+
+// AtomicBatch runs operations as one Batch on s, a store of p, failing with ErrBatchNotAtomic without applying
+// any of them if p doesn't apply batches atomically.
+func AtomicBatch(p storage.Provider, s storage.Store, operations []storage.Operation) error {
+	if !SupportsBatch(p) {
+		return ErrBatchNotAtomic
+	}
+
+	return s.Batch(operations)
+}
+
+// WithTransaction runs fn on a transaction over the store name of p: its writes are buffered and applied with one
+// atomic Batch once fn returns nil, so that either all of them or none are, and none are if fn fails or ctx is
+// done first. Get reads the buffered writes; the other reads see the store as it was. The store name is needed
+// since batches are atomic within a store only. ErrUnsupportedOperation is returned, without calling fn, if p
+// doesn't apply batches atomically, as told by SupportsBatch.
+func WithTransaction(ctx context.Context, p storage.Provider, name string, fn func(tx storage.Store) error) error {
+	if !SupportsBatch(p) {
+		return fmt.Errorf("transaction: %w: %s", ErrUnsupportedOperation, ErrBatchNotAtomic)
+	}
+
+	s, err := p.OpenStore(name)
+	if err != nil {
+		return fmt.Errorf("transaction: open store %s: %w", name, err)
+	}
+
+	tx := &txStore{Store: s, pending: map[string]int{}}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("transaction: %w", err)
+	}
+
+	if len(tx.operations) == 0 {
+		return nil
+	}
+
+	if err = s.Batch(tx.operations); err != nil {
+		return fmt.Errorf("transaction: %w", err)
+	}
+
+	return nil
+}
+
+// txStore buffers the writes made on the embedded store. pending has the index in operations of the last
+// buffered operation of each key.
+type txStore struct {
+	storage.Store
+	operations []storage.Operation
+	pending    map[string]int
+}
+
+func (s *txStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if value == nil {
+		return errors.New("value cannot be nil")
+	}
+
+	return s.Batch([]storage.Operation{{Key: key, Value: value, Tags: tags}})
+}
+
+func (s *txStore) Delete(key string) error {
+	return s.Batch([]storage.Operation{{Key: key}})
+}
+
+func (s *txStore) Batch(operations []storage.Operation) error {
+	for _, op := range operations {
+		if op.Key == "" {
+			return errors.New("key cannot be empty")
+		}
+	}
+
+	for _, op := range operations {
+		s.pending[op.Key] = len(s.operations)
+		s.operations = append(s.operations, op)
+	}
+
+	return nil
+}
+
+func (s *txStore) Get(key string) ([]byte, error) {
+	i, ok := s.pending[key]
+	if !ok {
+		return s.Store.Get(key)
+	}
+
+	if s.operations[i].Value == nil {
+		return nil, storage.ErrDataNotFound
+	}
+
+	return s.operations[i].Value, nil
+}
+
+// Flush does nothing, the writes being applied when the transaction ends.
+func (s *txStore) Flush() error {
+	return nil
+}
+
+// Close does nothing, the store being owned by the provider.
+func (s *txStore) Close() error {
+	return nil
+}
+
+func (p *builtProvider) driverCapabilities() Capabilities {
+	return p.capabilities
+}
+
+func (p *builtProvider) SupportsBatch() bool {
+	return p.capabilities.Transactions
+}
@@ -0,0 +1,161 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type batchCapableProvider struct {
+	storage.Provider
+}
+
+func (p *batchCapableProvider) SupportsBatch() bool {
+	return true
+}
+
+func TestSupportsBatch(t *testing.T) {
+	t.Run("fake providers", func(t *testing.T) {
+		require.True(t, SupportsBatch(&batchCapableProvider{Provider: mem.NewProvider()}))
+		require.False(t, SupportsBatch(mem.NewProvider()))
+	})
+
+	t.Run("built providers follow the driver capabilities", func(t *testing.T) {
+		registerTestDriver(t, "atomic", mem.NewProvider())
+
+		driverCapabilities["atomic"] = Capabilities{Transactions: true}
+
+		t.Cleanup(func() { delete(driverCapabilities, "atomic") })
+
+		p, err := BuildProvider(&DBParameters{URL: "atomic://test"}, logger, WithOperationHistory(1))
+		require.NoError(t, err)
+		require.True(t, SupportsBatch(p))
+
+		p, err = BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+		require.False(t, SupportsBatch(p))
+	})
+}
+
+func TestAtomicBatch(t *testing.T) {
+	operations := []storage.Operation{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}}
+
+	t.Run("batch-capable provider", func(t *testing.T) {
+		p := &batchCapableProvider{Provider: mem.NewProvider()}
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		require.NoError(t, AtomicBatch(p, s, operations))
+
+		value, err := s.Get("b")
+		require.NoError(t, err)
+		require.Equal(t, []byte("2"), value)
+	})
+
+	t.Run("non-capable provider", func(t *testing.T) {
+		p := mem.NewProvider()
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		require.ErrorIs(t, AtomicBatch(p, s, operations), ErrBatchNotAtomic)
+
+		_, err = s.Get("a")
+		require.True(t, IsNotFound(err))
+	})
+}
+
+func TestWithTransaction(t *testing.T) {
+	t.Run("applies all writes once fn succeeds", func(t *testing.T) {
+		p := &batchCapableProvider{Provider: mem.NewProvider()}
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("old", []byte("0")))
+
+		err = WithTransaction(context.Background(), p, "store", func(tx storage.Store) error {
+			require.NoError(t, tx.Put("a", []byte("1")))
+			require.NoError(t, tx.Delete("old"))
+
+			value, getErr := tx.Get("a")
+			require.NoError(t, getErr)
+			require.Equal(t, []byte("1"), value)
+
+			_, getErr = tx.Get("old")
+			require.True(t, IsNotFound(getErr))
+
+			// nothing is applied before fn returns
+			_, getErr = s.Get("a")
+			require.True(t, IsNotFound(getErr))
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		value, err := s.Get("a")
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), value)
+
+		_, err = s.Get("old")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("applies nothing when fn fails", func(t *testing.T) {
+		p := &batchCapableProvider{Provider: mem.NewProvider()}
+
+		err := WithTransaction(context.Background(), p, "store", func(tx storage.Store) error {
+			require.NoError(t, tx.Put("a", []byte("1")))
+			require.EqualError(t, tx.Put("", []byte("2")), "key cannot be empty")
+
+			return errors.New("aborted")
+		})
+		require.EqualError(t, err, "aborted")
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		_, err = s.Get("a")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("applies nothing when ctx is done", func(t *testing.T) {
+		p := &batchCapableProvider{Provider: mem.NewProvider()}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := WithTransaction(ctx, p, "store", func(tx storage.Store) error {
+			cancel()
+
+			return tx.Put("a", []byte("1"))
+		})
+		require.ErrorIs(t, err, context.Canceled)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		_, err = s.Get("a")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("unsupported without atomic batches", func(t *testing.T) {
+		called := false
+
+		err := WithTransaction(context.Background(), mem.NewProvider(), "store", func(storage.Store) error {
+			called = true
+
+			return nil
+		})
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+		require.False(t, called)
+	})
+}
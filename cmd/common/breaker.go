@@ -0,0 +1,109 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// ErrCircuitOpen is returned without calling the store while the circuit of WithCircuitBreaker is open.
+var ErrCircuitOpen = errors.New("storage circuit breaker is open")
+
+// WithCircuitBreaker fast-fails store operations with ErrCircuitOpen once threshold consecutive operations
+// have failed, until cooldown has elapsed on the clock given with WithClock. The next operation is then let
+// through as a trial: the circuit closes if it succeeds and opens for another cooldown if it fails. The circuit
+// is shared by all the stores of the provider. Not found errors, as told by IsNotFound, are not failures.
+// A threshold of zero or less disables the breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		if threshold <= 0 {
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			breaker := &circuitBreaker{threshold: threshold, cooldown: cooldown, clock: opts.clock}
+
+			return interceptStores(p, breaker.intercept)
+		})
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     Clock
+
+	mutex    sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+func (b *circuitBreaker) intercept(op, storeName, _ string, call func() error) error {
+	if !b.allow() {
+		return fmt.Errorf("%w: %s on store %s", ErrCircuitOpen, op, storeName)
+	}
+
+	err := call()
+	b.record(err == nil || IsNotFound(err))
+
+	return err
+}
+
+// allow reports whether an operation may run, moving an open circuit to half-open once the cooldown elapsed.
+// Only the trial operation runs while the circuit is half-open.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+
+		b.state = circuitHalfOpen
+
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if success {
+		b.state = circuitClosed
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = b.clock.Now()
+	}
+}
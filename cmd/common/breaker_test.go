@@ -0,0 +1,100 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	const cooldown = 10 * time.Second
+
+	open := func(t *testing.T, clock Clock, store *mockStore) storage.Store {
+		t.Helper()
+
+		registerTestDriver(t, "fake", &mockProvider{store: store})
+
+		p, err := BuildProvider(&DBParameters{URL: "fake://", Timeout: 1}, logger,
+			WithClock(clock), WithCircuitBreaker(2, cooldown))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("profiles")
+		require.NoError(t, err)
+
+		return s
+	}
+
+	t.Run("opens after consecutive failures and recovers", func(t *testing.T) {
+		clock := &manualClock{}
+		store := &mockStore{getErr: errors.New("timeout")}
+		s := open(t, clock, store)
+
+		// Closed: failures reach the store until the threshold.
+		for i := 0; i < 2; i++ {
+			_, err := s.Get("key")
+			require.EqualError(t, err, "timeout")
+		}
+
+		// Open: operations fail fast.
+		store.getErr = nil
+		_, err := s.Get("key")
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Contains(t, err.Error(), "Get on store profiles")
+
+		// Half-open after the cooldown: a successful trial closes the circuit.
+		clock.advance(cooldown)
+		_, err = s.Get("key")
+		require.NoError(t, err)
+
+		_, err = s.Get("key")
+		require.NoError(t, err)
+	})
+
+	t.Run("failed trial reopens the circuit", func(t *testing.T) {
+		clock := &manualClock{}
+		store := &mockStore{getErr: errors.New("timeout")}
+		s := open(t, clock, store)
+
+		for i := 0; i < 2; i++ {
+			_, err := s.Get("key")
+			require.EqualError(t, err, "timeout")
+		}
+
+		clock.advance(cooldown)
+		_, err := s.Get("key")
+		require.EqualError(t, err, "timeout")
+
+		store.getErr = nil
+		_, err = s.Get("key")
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		clock.advance(cooldown)
+		_, err = s.Get("key")
+		require.NoError(t, err)
+	})
+
+	t.Run("successes reset the failure count", func(t *testing.T) {
+		clock := &manualClock{}
+		store := &mockStore{}
+		s := open(t, clock, store)
+
+		for i := 0; i < 3; i++ {
+			store.getErr = errors.New("timeout")
+			_, err := s.Get("key")
+			require.EqualError(t, err, "timeout")
+
+			store.getErr = storage.ErrDataNotFound
+			_, err = s.Get("key")
+			require.ErrorIs(t, err, storage.ErrDataNotFound)
+		}
+	})
+}
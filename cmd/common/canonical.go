@@ -0,0 +1,90 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts are the ports the drivers connect to when a database URL has none, by scheme.
+// nolint:gochecknoglobals
+var defaultPorts = map[string]string{}
+
+// CanonicalizeURL returns the canonical form of the database URL raw, so that equivalent URLs can be compared:
+// the scheme and the host are lowercased, the default port of the driver is added to a host without one, and
+// the query parameters are sorted. The credentials and the path are kept as they are. Hosts wrapped in a
+// protocol, as in the MySQL DSN "tcp(host:port)", are canonicalized inside the wrapper.
+func CanonicalizeURL(raw string) (string, error) {
+	const schemeSeparator = "://"
+
+	if _, _, err := parseDBURL(raw); err != nil {
+		return "", err
+	}
+
+	separator := strings.Index(raw, schemeSeparator)
+	if separator < 0 {
+		return "", fmt.Errorf("invalid dbURL %s: missing %s", maskURL(raw), schemeSeparator)
+	}
+
+	scheme := strings.ToLower(raw[:separator])
+	rest := raw[separator+len(schemeSeparator):]
+
+	query := ""
+	if i := dsnQueryIndex(rest); i >= 0 {
+		values, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid query in dbURL %s: %w", maskURL(raw), err)
+		}
+
+		query, rest = "?"+values.Encode(), rest[:i]
+	}
+
+	userEnd := strings.LastIndex(rest, "@") + 1
+	address, path := splitAddress(rest[userEnd:])
+
+	if open := strings.Index(address, "("); open >= 0 && strings.HasSuffix(address, ")") {
+		address = address[:open+1] + canonicalHost(address[open+1:len(address)-1], defaultPorts[scheme]) + ")"
+	} else {
+		address = canonicalHost(address, defaultPorts[scheme])
+	}
+
+	return scheme + schemeSeparator + rest[:userEnd] + address + path + query, nil
+}
+
+// splitAddress splits the host part of a DSN, which may be wrapped in a protocol as in "tcp(host:port)", from
+// the path that follows it.
+func splitAddress(hostPath string) (string, string) {
+	end := strings.Index(hostPath, "/")
+
+	if closing := strings.Index(hostPath, ")"); closing >= 0 && strings.Contains(hostPath[:closing], "(") {
+		end = closing + 1
+	}
+
+	if end < 0 {
+		return hostPath, ""
+	}
+
+	return hostPath[:end], hostPath[end:]
+}
+
+// canonicalHost lowercases host and adds defaultPort to it if it has no port.
+func canonicalHost(host, defaultPort string) string {
+	host = strings.ToLower(host)
+
+	if host == "" || defaultPort == "" {
+		return host
+	}
+
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), defaultPort)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// changeFeedDefaultBuffer is the number of events WithChangeFeed buffers when no size is given.
+const changeFeedDefaultBuffer = 100
+
+// ChangeEvent describes a write made through a provider built WithChangeFeed.
+type ChangeEvent struct {
+	// Op is either Put or Delete. The operations of a Batch are published one by one.
+	Op string
+	// Store is the name the store was opened with.
+	Store string
+	Key   string
+}
+
+// ChangeNotifier is implemented by the providers returned by BuildProvider.
+type ChangeNotifier interface {
+	// Changes returns the channel the writes are published on, which is closed when the provider is closed.
+	// It is nil unless the provider was built WithChangeFeed.
+	Changes() <-chan ChangeEvent
+}
+
+// WithChangeFeed publishes a ChangeEvent for every successful Put and Delete made through the provider,
+// including those of a Batch, on the channel returned by Changes, so that other components can react to writes,
+// for example by invalidating caches. Reads are not published. Up to bufferSize events are buffered, 100 if it is
+// zero or less; events published while the buffer is full are dropped so that slow consumers never stall
+// writes.
+func WithChangeFeed(bufferSize int) BuildOption {
+	return func(opts *buildOptions) {
+		if bufferSize <= 0 {
+			bufferSize = changeFeedDefaultBuffer
+		}
+
+		feed := &changeFeed{events: make(chan ChangeEvent, bufferSize)}
+		opts.changes = feed
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(name string, s storage.Store) storage.Store {
+				return &changeFeedStore{Store: s, name: name, feed: feed}
+			})
+		})
+	}
+}
+
+type changeFeed struct {
+	mutex  sync.RWMutex
+	events chan ChangeEvent
+	closed bool
+}
+
+// publish sends event unless the buffer is full or the feed is closed.
+func (f *changeFeed) publish(event ChangeEvent) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
+		return
+	}
+
+	select {
+	case f.events <- event:
+	default:
+	}
+}
+
+func (f *changeFeed) close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.closed {
+		f.closed = true
+		close(f.events)
+	}
+
+	return nil
+}
+
+func (p *builtProvider) Changes() <-chan ChangeEvent {
+	if p.changes == nil {
+		return nil
+	}
+
+	return p.changes.events
+}
+
+type changeFeedStore struct {
+	storage.Store
+	name string
+	feed *changeFeed
+}
+
+func (s *changeFeedStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if err := s.Store.Put(key, value, tags...); err != nil {
+		return err
+	}
+
+	s.feed.publish(ChangeEvent{Op: "Put", Store: s.name, Key: key})
+
+	return nil
+}
+
+func (s *changeFeedStore) Delete(key string) error {
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+
+	s.feed.publish(ChangeEvent{Op: "Delete", Store: s.name, Key: key})
+
+	return nil
+}
+
+func (s *changeFeedStore) Batch(operations []storage.Operation) error {
+	if err := s.Store.Batch(operations); err != nil {
+		return err
+	}
+
+	for _, op := range operations {
+		event := ChangeEvent{Op: "Put", Store: s.name, Key: op.Key}
+		if op.Value == nil {
+			event.Op = "Delete"
+		}
+
+		s.feed.publish(event)
+	}
+
+	return nil
+}
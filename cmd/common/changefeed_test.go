@@ -0,0 +1,106 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithChangeFeed(t *testing.T) {
+	drain := func(changes <-chan ChangeEvent) []ChangeEvent {
+		var events []ChangeEvent
+
+		for {
+			select {
+			case event := <-changes:
+				events = append(events, event)
+			default:
+				return events
+			}
+		}
+	}
+
+	t.Run("publishes writes but not reads", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithChangeFeed(10))
+		require.NoError(t, err)
+
+		changes := p.(ChangeNotifier).Changes()
+
+		s, err := p.OpenStore("users")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("alice", []byte("1")))
+		_, err = s.Get("alice")
+		require.NoError(t, err)
+		_, err = s.GetBulk("alice")
+		require.NoError(t, err)
+		require.NoError(t, s.Delete("alice"))
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "bob", Value: []byte("2")}, {Key: "carol"}}))
+
+		require.Equal(t, []ChangeEvent{
+			{Op: "Put", Store: "users", Key: "alice"},
+			{Op: "Delete", Store: "users", Key: "alice"},
+			{Op: "Put", Store: "users", Key: "bob"},
+			{Op: "Delete", Store: "users", Key: "carol"},
+		}, drain(changes))
+
+		require.NoError(t, p.Close())
+
+		_, open := <-changes
+		require.False(t, open)
+	})
+
+	t.Run("failed writes are not published", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithMaxValueSize(1), WithChangeFeed(10))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("users")
+		require.NoError(t, err)
+
+		require.Error(t, s.Put("alice", []byte("too large")))
+		require.Empty(t, drain(p.(ChangeNotifier).Changes()))
+	})
+
+	t.Run("a full buffer does not block writes", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithChangeFeed(2))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("users")
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			for _, key := range []string{"a", "b", "c", "d"} {
+				require.NoError(t, s.Put(key, []byte("value")))
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			require.Fail(t, "writes blocked on the full buffer")
+		}
+
+		require.Equal(t, []ChangeEvent{
+			{Op: "Put", Store: "users", Key: "a"},
+			{Op: "Put", Store: "users", Key: "b"},
+		}, drain(p.(ChangeNotifier).Changes()))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+		require.Nil(t, p.(ChangeNotifier).Changes())
+	})
+}
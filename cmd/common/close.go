@@ -0,0 +1,383 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// ErrNotBuiltProvider is returned by OnClose for providers that were not returned by BuildProvider.
+var ErrNotBuiltProvider = errors.New("provider was not built with BuildProvider")
+
+// ErrProviderClosed is returned by the providers returned by BuildProvider, and by their stores, for any
+// operation other than Close attempted after Close, instead of whatever the driver does with a closed connection.
+var ErrProviderClosed = errors.New("storage provider is closed")
+
+// ErrCloseTimeout is returned by CloseEdgeStore and CloseEdgeStoreTimeout when the provider did not close in time.
+var ErrCloseTimeout = errors.New("storage provider did not close in time")
+
+// CloseEdgeStore closes p within params.CloseTimeout, or DatabaseCloseTimeoutDefault if it is not set, see
+// CloseEdgeStoreTimeout.
+func CloseEdgeStore(p storage.Provider, params *DBParameters) error {
+	return closeEdgeStore(p, params, systemClock{})
+}
+
+func closeEdgeStore(p storage.Provider, params *DBParameters, clock Clock) error {
+	timeout := params.CloseTimeout
+	if timeout <= 0 {
+		timeout = DatabaseCloseTimeoutDefault
+	}
+
+	return closeWithTimeout(p, timeout, clock)
+}
+
+// CloseEdgeStoreTimeout closes p, returning an error wrapping ErrCloseTimeout if that takes longer than timeout, so
+// that shutdown is bounded whatever the driver does. The close is abandoned, not cancelled: it keeps running in
+// the background.
+func CloseEdgeStoreTimeout(p storage.Provider, timeout time.Duration) error {
+	return closeWithTimeout(p, timeout, systemClock{})
+}
+
+func closeWithTimeout(p storage.Provider, timeout time.Duration, clock Clock) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- p.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-clock.After(timeout):
+		return fmt.Errorf("%w: waited %s", ErrCloseTimeout, timeout)
+	}
+}
+
+// InstallSignalShutdown returns a child of ctx that is cancelled on SIGINT or SIGTERM, after which p is closed
+// with CloseEdgeStoreTimeout within timeout, or DatabaseCloseTimeoutDefault if it is zero or less, the error of
+// the close being logged. The signals are no longer listened for once one is received, so that a second one
+// terminates the process as by default if closing hangs. The returned function stops listening for the signals
+// and cancels the context; if a signal was received it also waits for p to be closed, so that it can be deferred
+// in main. Otherwise p is left open for the caller to close.
+func InstallSignalShutdown(ctx context.Context, p storage.Provider, logger log.Logger,
+	timeout time.Duration) (context.Context, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	return signalShutdown(ctx, p, logger, timeout, signals, func() { signal.Stop(signals) })
+}
+
+// signalShutdown is InstallSignalShutdown for the signals received on signals, stop ending their delivery. stop
+// may be called twice.
+func signalShutdown(ctx context.Context, p storage.Provider, logger log.Logger, timeout time.Duration,
+	signals <-chan os.Signal, stop func()) (context.Context, func()) {
+	if timeout <= 0 {
+		timeout = DatabaseCloseTimeoutDefault
+	}
+
+	shutdownCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		select {
+		case sig := <-signals:
+			stop()
+			logger.Infof("received %s, closing storage", sig)
+			cancel()
+
+			if err := CloseEdgeStoreTimeout(p, timeout); err != nil {
+				logger.Errorf("failed to close storage on %s: %s", sig, err)
+			}
+		case <-shutdownCtx.Done():
+		}
+	}()
+
+	return shutdownCtx, func() {
+		stop()
+		cancel()
+		<-done
+	}
+}
+
+// ErrDrainTimeout is returned by DrainClose when store operations were still running once its context was done.
+var ErrDrainTimeout = errors.New("storage operations still running")
+
+// DrainClose closes p, as returned by BuildProvider, once the store operations in flight on it are done: new
+// operations fail with ErrProviderClosed at once, and those running are waited for until ctx is done. p is then
+// closed anyway, and an error wrapping ErrDrainTimeout is returned with the number of operations still running,
+// together with the error of Close. ErrNotBuiltProvider is returned for other providers, which are not closed.
+func DrainClose(ctx context.Context, p storage.Provider) error {
+	d, ok := p.(drainer)
+	if !ok {
+		return ErrNotBuiltProvider
+	}
+
+	var errs multiError
+
+	select {
+	case <-d.drain():
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("%w: %d in flight", ErrDrainTimeout, d.inFlightOperations()))
+	}
+
+	if err := p.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs.errorOrNil()
+}
+
+// drainer is implemented by the providers returned by BuildProvider.
+type drainer interface {
+	drain() <-chan struct{}
+	inFlightOperations() int
+}
+
+// closeHookRegistrar is implemented by the providers returned by BuildProvider.
+type closeHookRegistrar interface {
+	addCloseHook(fn func() error)
+}
+
+// OnClose registers fn to run when p, as returned by BuildProvider, is closed. Hooks run in the reverse order of
+// their registration, before the provider itself is closed, and their errors are returned together with that
+// of the provider by Close.
+func OnClose(p storage.Provider, fn func() error) error {
+	registrar, ok := p.(closeHookRegistrar)
+	if !ok {
+		return ErrNotBuiltProvider
+	}
+
+	registrar.addCloseHook(fn)
+
+	return nil
+}
+
+// builtProvider is the provider returned by BuildProvider.
+type builtProvider struct {
+	storage.Provider
+	healthStoreName string
+	pingQueryText   string
+	capabilities    Capabilities
+	storeTimeouts   *storeTimeouts
+	changes         *changeFeed
+	// conn is the connection to the driver, unless the provider reconnects on its own
+	conn storage.Provider
+	// entryTagging is set for the providers built WithEntryTagging
+	entryTagging bool
+
+	// closed is set to 1 by Close
+	closed int32
+
+	mutex      sync.Mutex
+	closeHooks []func() error
+	storeNames map[string]bool
+
+	// opsMutex guards the count of the store operations in flight, draining, set by drain, and drained, closed
+	// once draining with no operation in flight
+	opsMutex sync.Mutex
+	inFlight int
+	draining bool
+	drained  chan struct{}
+}
+
+func (p *builtProvider) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) != 0
+}
+
+// guardClosed fails the store operations made after Close or drain with ErrProviderClosed, and counts the
+// others while they run.
+func (p *builtProvider) guardClosed(_, _, _ string, call func() error) error {
+	p.opsMutex.Lock()
+
+	if p.isClosed() || p.draining {
+		p.opsMutex.Unlock()
+
+		return ErrProviderClosed
+	}
+
+	p.inFlight++
+	p.opsMutex.Unlock()
+
+	defer func() {
+		p.opsMutex.Lock()
+		defer p.opsMutex.Unlock()
+
+		p.inFlight--
+
+		if p.draining && p.inFlight == 0 {
+			close(p.drained)
+		}
+	}()
+
+	return call()
+}
+
+// drain stops accepting store operations and returns a channel closed once those in flight are done.
+func (p *builtProvider) drain() <-chan struct{} {
+	p.opsMutex.Lock()
+	defer p.opsMutex.Unlock()
+
+	if !p.draining {
+		p.draining = true
+		p.drained = make(chan struct{})
+
+		if p.inFlight == 0 {
+			close(p.drained)
+		}
+	}
+
+	return p.drained
+}
+
+func (p *builtProvider) inFlightOperations() int {
+	p.opsMutex.Lock()
+	defer p.opsMutex.Unlock()
+
+	return p.inFlight
+}
+
+func (p *builtProvider) OpenStore(name string) (storage.Store, error) {
+	if p.isClosed() {
+		return nil, ErrProviderClosed
+	}
+
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+
+	if p.storeNames == nil {
+		p.storeNames = map[string]bool{}
+	}
+
+	p.storeNames[name] = true
+	p.mutex.Unlock()
+
+	return &builtStore{
+		interceptedStore: &interceptedStore{Store: store, name: name, intercept: p.guardClosed},
+		entryTagging:     p.entryTagging,
+	}, nil
+}
+
+// tagsEntries reports whether the provider was built WithEntryTagging.
+func (p *builtProvider) tagsEntries() bool {
+	return p.entryTagging
+}
+
+// builtStore is a store opened on a builtProvider.
+type builtStore struct {
+	*interceptedStore
+	entryTagging bool
+}
+
+func (s *builtStore) tagsEntries() bool {
+	return s.entryTagging
+}
+
+// openStoreNames returns the sorted names of the stores opened on the provider.
+func (p *builtProvider) openStoreNames() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.storeNames))
+	for name := range p.storeNames {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (p *builtProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	if p.isClosed() {
+		return ErrProviderClosed
+	}
+
+	return p.Provider.SetStoreConfig(name, config)
+}
+
+func (p *builtProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	if p.isClosed() {
+		return storage.StoreConfiguration{}, ErrProviderClosed
+	}
+
+	return p.Provider.GetStoreConfig(name)
+}
+
+// GetOpenStores returns no stores once the provider is closed.
+func (p *builtProvider) GetOpenStores() []storage.Store {
+	if p.isClosed() {
+		return nil
+	}
+
+	return p.Provider.GetOpenStores()
+}
+
+func (p *builtProvider) healthStore() string {
+	return p.healthStoreName
+}
+
+func (p *builtProvider) pingQuery() string {
+	return p.pingQueryText
+}
+
+// setStoreTimeout gives the store name its own operation timeout, returning false if the provider was not built
+// WithOperationTimeout.
+func (p *builtProvider) setStoreTimeout(name string, d time.Duration) bool {
+	return p.storeTimeouts.setIfEnabled(name, d)
+}
+
+func (p *builtProvider) addCloseHook(fn func() error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closeHooks = append(p.closeHooks, fn)
+}
+
+// Close runs the close hooks and closes the provider. Closing it again does nothing and returns nil, so that a
+// provider closed by InstallSignalShutdown can still be closed by a deferred Close.
+func (p *builtProvider) Close() error {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return nil
+	}
+
+	p.mutex.Lock()
+	hooks := p.closeHooks
+	p.closeHooks = nil
+	p.mutex.Unlock()
+
+	var errs multiError
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := p.Provider.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs.errorOrNil()
+}
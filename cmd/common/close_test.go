@@ -0,0 +1,356 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnClose(t *testing.T) {
+	t.Run("hooks run in LIFO order before the provider closes", func(t *testing.T) {
+		backend := &mockProvider{}
+		registerTestDriver(t, "hooked", backend)
+
+		p, err := BuildProvider(&DBParameters{URL: "hooked://test"}, logger, WithOperationHistory(1))
+		require.NoError(t, err)
+
+		var calls []string
+
+		for _, name := range []string{"metrics", "cache"} {
+			name := name
+
+			require.NoError(t, OnClose(p, func() error {
+				require.False(t, backend.closed)
+				calls = append(calls, name)
+
+				return nil
+			}))
+		}
+
+		require.NoError(t, p.Close())
+		require.Equal(t, []string{"cache", "metrics"}, calls)
+		require.True(t, backend.closed)
+	})
+
+	t.Run("errors are aggregated", func(t *testing.T) {
+		backend := &mockProvider{closeErr: errors.New("close connection")}
+		registerTestDriver(t, "hooked", backend)
+
+		p, err := BuildProvider(&DBParameters{URL: "hooked://test"}, logger)
+		require.NoError(t, err)
+
+		errFlush := errors.New("flush cache")
+
+		require.NoError(t, OnClose(p, func() error { return errors.New("stop metrics") }))
+		require.NoError(t, OnClose(p, func() error { return nil }))
+		require.NoError(t, OnClose(p, func() error { return errFlush }))
+
+		err = p.Close()
+		require.EqualError(t, err, "flush cache; stop metrics; close connection")
+		require.ErrorIs(t, err, errFlush)
+	})
+
+	t.Run("provider not built with BuildProvider", func(t *testing.T) {
+		require.ErrorIs(t, OnClose(mem.NewProvider(), func() error { return nil }), ErrNotBuiltProvider)
+	})
+}
+
+// closedPanicProvider is a provider whose stores panic once it is closed, as some drivers do.
+type closedPanicProvider struct {
+	storage.Provider
+	closed bool
+}
+
+func (p *closedPanicProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &closedPanicStore{Store: store, provider: p}, nil
+}
+
+func (p *closedPanicProvider) Close() error {
+	p.closed = true
+
+	return nil
+}
+
+type closedPanicStore struct {
+	storage.Store
+	provider *closedPanicProvider
+}
+
+func (s *closedPanicStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if s.provider.closed {
+		panic("use of closed connection")
+	}
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func TestCloseEdgeStore(t *testing.T) {
+	slowProvider := func() *MockProvider {
+		p := NewMockProvider()
+		p.SetLatency("Close", time.Minute)
+
+		return p
+	}
+
+	t.Run("configured timeout", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+
+		require.NoError(t, os.Setenv(DatabaseCloseTimeoutEnvKey, "3s"))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, 3*time.Second, params.CloseTimeout)
+
+		clock := newFakeClock()
+
+		err = closeEdgeStore(slowProvider(), params, clock)
+		require.True(t, errors.Is(err, ErrCloseTimeout))
+		require.Equal(t, 3*time.Second, clock.Now().Sub(clock.start))
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		clock := newFakeClock()
+
+		err := closeEdgeStore(slowProvider(), &DBParameters{}, clock)
+		require.True(t, errors.Is(err, ErrCloseTimeout))
+		require.Equal(t, DatabaseCloseTimeoutDefault, clock.Now().Sub(clock.start))
+	})
+
+	t.Run("closes in time", func(t *testing.T) {
+		p := NewMockProvider()
+		require.NoError(t, CloseEdgeStore(p, &DBParameters{}))
+		require.Equal(t, 1, p.Calls("Close"))
+
+		p.SetError("Close", errors.New("close failed"))
+		require.EqualError(t, CloseEdgeStoreTimeout(p, time.Second), "close failed")
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+
+		require.NoError(t, os.Setenv(DatabaseCloseTimeoutEnvKey, "soon"))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		_, err := DBParams(cmd)
+		require.Equal(t, ErrCodeInvalidTimeout, ErrorCode(err))
+	})
+}
+
+func TestErrProviderClosed(t *testing.T) {
+	registerTestDriver(t, "closing", &closedPanicProvider{Provider: mem.NewProvider()})
+
+	p, err := BuildProvider(&DBParameters{URL: "closing://test"}, logger)
+	require.NoError(t, err)
+
+	s, err := p.OpenStore("store")
+	require.NoError(t, err)
+	require.NoError(t, s.Put("key", []byte("value")))
+
+	require.NoError(t, p.Close())
+
+	require.NotPanics(t, func() {
+		require.ErrorIs(t, s.Put("key", []byte("value")), ErrProviderClosed)
+	})
+
+	_, err = s.Get("key")
+	require.ErrorIs(t, err, ErrProviderClosed)
+
+	_, err = p.OpenStore("store")
+	require.ErrorIs(t, err, ErrProviderClosed)
+
+	require.ErrorIs(t, p.SetStoreConfig("store", storage.StoreConfiguration{}), ErrProviderClosed)
+
+	_, err = p.GetStoreConfig("store")
+	require.ErrorIs(t, err, ErrProviderClosed)
+
+	require.Empty(t, p.GetOpenStores())
+	require.NoError(t, p.Close())
+}
+
+func TestDrainClose(t *testing.T) {
+	// setup returns a provider whose store reads wait for release, with one read started
+	setup := func(t *testing.T) (storage.Provider, *mockProvider, *blockingStore, chan error) {
+		t.Helper()
+
+		backend := &mockProvider{Provider: mem.NewProvider(), store: &blockingStore{release: make(chan struct{})}}
+		registerTestDriver(t, "draining", backend)
+
+		p, err := BuildProvider(&DBParameters{URL: "draining://test"}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+
+		go func() {
+			_, getErr := s.Get("key")
+			done <- getErr
+		}()
+
+		blocking := backend.store.(*blockingStore)
+
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt32(&blocking.gets) == 1
+		}, time.Second, time.Millisecond)
+
+		return p, backend, blocking, done
+	}
+
+	t.Run("operations complete before the deadline", func(t *testing.T) {
+		p, backend, blocking, done := setup(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		drained := make(chan error, 1)
+
+		go func() {
+			drained <- DrainClose(ctx, p)
+		}()
+
+		require.Eventually(t, func() bool {
+			s, err := p.OpenStore("store")
+			if err != nil {
+				return false
+			}
+
+			return errors.Is(s.Put("key", []byte("value")), ErrProviderClosed)
+		}, time.Second, time.Millisecond)
+		require.False(t, backend.closed)
+
+		close(blocking.release)
+
+		require.NoError(t, <-done)
+		require.NoError(t, <-drained)
+		require.True(t, backend.closed)
+	})
+
+	t.Run("operations still running at the deadline", func(t *testing.T) {
+		p, backend, blocking, done := setup(t)
+		defer close(blocking.release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := DrainClose(ctx, p)
+		require.ErrorIs(t, err, ErrDrainTimeout)
+		require.EqualError(t, err, "storage operations still running: 1 in flight")
+		require.True(t, backend.closed)
+
+		select {
+		case <-done:
+			t.Fatal("the operation should still be running")
+		default:
+		}
+	})
+
+	t.Run("no operation in flight", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+
+		require.NoError(t, DrainClose(context.Background(), p))
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("not built provider", func(t *testing.T) {
+		require.ErrorIs(t, DrainClose(context.Background(), mem.NewProvider()), ErrNotBuiltProvider)
+	})
+}
+
+func TestInstallSignalShutdown(t *testing.T) {
+	t.Run("signal cancels the context and closes the provider", func(t *testing.T) {
+		p := &mockProvider{}
+		signals := make(chan os.Signal, 1)
+
+		var stopped int32
+
+		ctx, stop := signalShutdown(context.Background(), p, logger, time.Second, signals,
+			func() { atomic.AddInt32(&stopped, 1) })
+
+		signals <- syscall.SIGTERM
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			require.Fail(t, "context not cancelled")
+		}
+
+		// the signals are no longer listened for once the first one is received
+		require.Equal(t, int32(1), atomic.LoadInt32(&stopped))
+
+		stop()
+		require.True(t, p.closed)
+		require.Equal(t, int32(2), atomic.LoadInt32(&stopped))
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("a built provider can still be closed after the signal", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+
+		signals := make(chan os.Signal, 1)
+
+		ctx, stop := signalShutdown(context.Background(), p, logger, time.Second, signals, func() {})
+
+		signals <- syscall.SIGTERM
+		<-ctx.Done()
+
+		// waits for the provider to be closed
+		stop()
+
+		_, err = p.OpenStore("store")
+		require.ErrorIs(t, err, ErrProviderClosed)
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("stop without a signal leaves the provider open", func(t *testing.T) {
+		p := &mockProvider{}
+
+		ctx, stop := signalShutdown(context.Background(), p, logger, time.Second, make(chan os.Signal), func() {})
+		require.NoError(t, ctx.Err())
+
+		stop()
+		require.Error(t, ctx.Err())
+		require.False(t, p.closed)
+	})
+
+	t.Run("parent context done", func(t *testing.T) {
+		p := &mockProvider{}
+		parent, cancel := context.WithCancel(context.Background())
+
+		ctx, stop := InstallSignalShutdown(parent, p, logger, 0)
+
+		cancel()
+		<-ctx.Done()
+		stop()
+		require.False(t, p.closed)
+	})
+}
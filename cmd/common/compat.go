@@ -0,0 +1,42 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// CompatModeLegacy is the DatabaseCompatModeEnvKey value that keeps the behavior of the storage drivers before
+// their upgrade.
+const CompatModeLegacy = "legacy"
+
+// legacyErrorDrivers are the drivers whose upgrade changed the errors reported for missing data, which now wrap
+// storage.ErrDataNotFound or report it in the backend's own terms.
+// nolint:gochecknoglobals
+var legacyErrorDrivers = map[string]bool{}
+
+// withCompatMode restores the legacy behavior of the driver of params if params.CompatMode selects it and the
+// driver's behavior changed: every not found error, as told by IsNotFound, is then reported as
+// storage.ErrDataNotFound itself, so that callers comparing errors with == keep working.
+func withCompatMode(params *DBParameters) BuildOption {
+	return func(opts *buildOptions) {
+		if params.CompatMode != CompatModeLegacy || !legacyErrorDrivers[driverName(params)] {
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return interceptStores(p, func(_, _, _ string, call func() error) error {
+				err := call()
+				if IsNotFound(err) {
+					return storage.ErrDataNotFound
+				}
+
+				return err
+			})
+		})
+	}
+}
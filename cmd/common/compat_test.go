@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompatMode(t *testing.T) {
+	notFound := fmt.Errorf("get document: %w", &httpStatusError{status: http.StatusNotFound})
+
+	build := func(t *testing.T, mode string) storage.Store {
+		t.Helper()
+
+		registerTestDriver(t, "upgraded", &mockProvider{store: &mockStore{getErr: notFound}})
+
+		legacyErrorDrivers["upgraded"] = true
+
+		t.Cleanup(func() { delete(legacyErrorDrivers, "upgraded") })
+
+		p, err := BuildProvider(&DBParameters{URL: "upgraded://test", CompatMode: mode}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		return s
+	}
+
+	t.Run("legacy mode reports storage.ErrDataNotFound", func(t *testing.T) {
+		_, err := build(t, CompatModeLegacy).Get("missing")
+		require.True(t, err == storage.ErrDataNotFound) // nolint:errorlint
+	})
+
+	t.Run("default mode reports the driver's error", func(t *testing.T) {
+		_, err := build(t, "").Get("missing")
+		require.Equal(t, notFound, err)
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("unaffected drivers keep the driver's error", func(t *testing.T) {
+		registerTestDriver(t, "unaffected", &mockProvider{store: &mockStore{getErr: notFound}})
+
+		p, err := BuildProvider(&DBParameters{URL: "unaffected://test", CompatMode: CompatModeLegacy}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		_, err = s.Get("missing")
+		require.Equal(t, notFound, err)
+	})
+
+	t.Run("DBParams", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		require.NoError(t, os.Setenv(DatabaseCompatModeEnvKey, "Legacy"))
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, CompatModeLegacy, params.CompatMode)
+
+		require.NoError(t, os.Setenv(DatabaseCompatModeEnvKey, "ancient"))
+		_, err = DBParams(cmd)
+		require.EqualError(t, err, "failed to configure dbCompatMode: unknown mode ancient, "+
+			"the supported mode is legacy")
+	})
+}
@@ -0,0 +1,192 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// CompressedTagName is the tag of the values stored gzip-compressed by providers built WithCompression.
+const CompressedTagName = "gzip"
+
+// gzipMagic starts every gzip stream, so that only values starting with it need their tags checked on reads.
+var gzipMagic = []byte{0x1f, 0x8b} // nolint:gochecknoglobals
+
+// WithCompression gzip-compresses the values larger than minSize bytes written with Put or Batch, tagging them
+// with CompressedTagName, and decompresses them on Get, GetBulk and Query. Smaller values are stored as is.
+func WithCompression(minSize int) BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &compressedStore{Store: s, minSize: minSize}
+			})
+		})
+	}
+}
+
+type compressedStore struct {
+	storage.Store
+	minSize int
+}
+
+func (s *compressedStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	value, tags, err := s.compress(value, tags)
+	if err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *compressedStore) Get(key string) ([]byte, error) {
+	value, err := s.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decompressStored(key, value)
+}
+
+func (s *compressedStore) GetBulk(keys ...string) ([][]byte, error) {
+	values, err := s.Store.GetBulk(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		if values[i], err = s.decompressStored(keys[i], value); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func (s *compressedStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decompressingIterator{Iterator: iterator}, nil
+}
+
+func (s *compressedStore) Batch(operations []storage.Operation) error {
+	compressed := make([]storage.Operation, len(operations))
+
+	for i, op := range operations {
+		compressed[i] = op
+
+		if op.Value == nil {
+			continue
+		}
+
+		var err error
+		if compressed[i].Value, compressed[i].Tags, err = s.compress(op.Value, op.Tags); err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Batch(compressed)
+}
+
+func (s *compressedStore) compress(value []byte, tags []storage.Tag) ([]byte, []storage.Tag, error) {
+	if len(value) <= s.minSize {
+		return value, tags, nil
+	}
+
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+
+	if _, err := writer.Write(value); err != nil {
+		return nil, nil, fmt.Errorf("compress value: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, nil, fmt.Errorf("compress value: %w", err)
+	}
+
+	tags = append(append([]storage.Tag{}, tags...), storage.Tag{Name: CompressedTagName})
+
+	return compressed.Bytes(), tags, nil
+}
+
+// decompressStored decompresses value if it is tagged as compressed. The tags are only read for values that
+// start like a gzip stream.
+func (s *compressedStore) decompressStored(key string, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, gzipMagic) {
+		return value, nil
+	}
+
+	tags, err := s.Store.GetTags(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressTagged(key, value, tags)
+}
+
+func decompressTagged(key string, value []byte, tags []storage.Tag) ([]byte, error) {
+	if !hasTag(tags, CompressedTagName) {
+		return value, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", truncateKey(key), err)
+	}
+
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", truncateKey(key), err)
+	}
+
+	return decompressed, nil
+}
+
+func hasTag(tags []storage.Tag, name string) bool {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+type decompressingIterator struct {
+	storage.Iterator
+}
+
+func (i *decompressingIterator) Value() ([]byte, error) {
+	value, err := i.Iterator.Value()
+	if err != nil || !bytes.HasPrefix(value, gzipMagic) {
+		return value, err
+	}
+
+	key, err := i.Iterator.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := i.Iterator.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressTagged(key, value, tags)
+}
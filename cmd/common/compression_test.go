@@ -0,0 +1,91 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCompression(t *testing.T) {
+	document := bytes.Repeat([]byte(`{"type":"VerifiableCredential","issuer":"did:example:123"}`), 100)
+
+	backend := mem.NewProvider()
+	registerTestDriver(t, "compressed", backend)
+
+	p, err := BuildProvider(&DBParameters{URL: "compressed://test"}, logger, WithCompression(64),
+		WithEntryTagging())
+	require.NoError(t, err)
+
+	s, err := p.OpenStore("documents")
+	require.NoError(t, err)
+
+	raw, err := backend.OpenStore("documents")
+	require.NoError(t, err)
+
+	t.Run("round trips a large value", func(t *testing.T) {
+		require.NoError(t, s.Put("vc", document, storage.Tag{Name: "kind", Value: "vc"}))
+
+		stored, err := raw.Get("vc")
+		require.NoError(t, err)
+		require.Less(t, len(stored), len(document))
+
+		tags, err := raw.GetTags("vc")
+		require.NoError(t, err)
+		require.True(t, hasTag(tags, CompressedTagName))
+		require.True(t, hasTag(tags, "kind"))
+
+		value, err := s.Get("vc")
+		require.NoError(t, err)
+		require.Equal(t, document, value)
+
+		values, err := s.GetBulk("vc", "missing")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{document, nil}, values)
+	})
+
+	t.Run("leaves small values uncompressed", func(t *testing.T) {
+		small := []byte("short")
+		require.NoError(t, s.Put("small", small))
+
+		stored, err := raw.Get("small")
+		require.NoError(t, err)
+		require.Equal(t, small, stored)
+
+		value, err := s.Get("small")
+		require.NoError(t, err)
+		require.Equal(t, small, value)
+	})
+
+	t.Run("uncompressed values that look like gzip", func(t *testing.T) {
+		lookalike := append([]byte{0x1f, 0x8b}, "not gzip"...)
+		require.NoError(t, s.Put("lookalike", lookalike))
+
+		value, err := s.Get("lookalike")
+		require.NoError(t, err)
+		require.Equal(t, lookalike, value)
+	})
+
+	t.Run("batch and query", func(t *testing.T) {
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "batched", Value: document}, {Key: "small"}}))
+
+		snap := snapshotValues(t, s)
+		require.Equal(t, document, snap["batched"])
+		require.Equal(t, document, snap["vc"])
+		require.NotContains(t, snap, "small")
+
+		// raw only holds the entries written through s, all tagged
+		equal, _, err := EqualContents(context.Background(), s, &entryTaggedStore{Store: raw})
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+}
@@ -0,0 +1,66 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// nolint:gochecknoglobals
+var (
+	warnConflicts      bool
+	warnConflictsMutex sync.RWMutex
+)
+
+// WarnOnConflicts toggles a mode in which DBParams logs a warning for every setting whose flag and environment
+// variable are both set to different values. The flag always wins; the warning surfaces the double
+// configuration that would otherwise go unnoticed.
+func WarnOnConflicts(enabled bool) {
+	warnConflictsMutex.Lock()
+	defer warnConflictsMutex.Unlock()
+
+	warnConflicts = enabled
+}
+
+func isWarnOnConflicts() bool {
+	warnConflictsMutex.RLock()
+	defer warnConflictsMutex.RUnlock()
+
+	return warnConflicts
+}
+
+// warnConflictingSettings logs the settings of cmd whose flag and environment variable disagree, masking the
+// database URLs, when WarnOnConflicts is enabled.
+func warnConflictingSettings(cmd *cobra.Command) {
+	if !isWarnOnConflicts() {
+		return
+	}
+
+	for _, setting := range dbFlags() {
+		flag := cmd.Flags().Lookup(setting.name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+
+		envValue, ok := os.LookupEnv(setting.envKey)
+		if !ok || envValue == flag.Value.String() {
+			continue
+		}
+
+		flagValue := flag.Value.String()
+
+		if setting.name == DatabaseURLFlagName || setting.name == DatabaseReplicaURLFlagName {
+			flagValue, envValue = maskURL(flagValue), maskURL(envValue)
+		}
+
+		packageLogger().Warnf("flag --%s=%s overrides conflicting environment variable %s=%s",
+			setting.name, flagValue, setting.envKey, envValue)
+	}
+}
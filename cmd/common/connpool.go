@@ -0,0 +1,135 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// nolint:gochecknoglobals
+var (
+	connPool      map[string]*pooledConnection
+	connPoolOn    bool
+	connPoolMutex sync.Mutex
+)
+
+// UseConnectionPool makes InitEdgeStore reuse, while enabled, the provider connected by an earlier call of the
+// process for the same canonical URL, driver, database name and prefix, so that repeated calls don't pay the
+// connection setup again; the other parameters of the later calls are ignored. Each call returns its own handle
+// on the shared provider, which is closed once every handle is. Connections are not pooled by default; disabling
+// the pool leaves the providers in use open until their handles are closed.
+func UseConnectionPool(enabled bool) {
+	connPoolMutex.Lock()
+	defer connPoolMutex.Unlock()
+
+	connPoolOn = enabled
+	connPool = map[string]*pooledConnection{}
+}
+
+// pooledConnection is a provider of the connection pool with the number of its open handles.
+type pooledConnection struct {
+	key      string
+	once     sync.Once
+	provider storage.Provider
+	err      error
+	refs     int
+}
+
+// connPoolKey returns the key of the connection of params in the pool, and false if connections are not pooled
+// or the URL cannot be canonicalized, in which case InitEdgeStore connects as usual.
+func connPoolKey(params *DBParameters) (string, bool) {
+	connPoolMutex.Lock()
+	enabled := connPoolOn
+	connPoolMutex.Unlock()
+
+	if !enabled {
+		return "", false
+	}
+
+	canonical, err := CanonicalizeURL(params.URL)
+	if err != nil {
+		return "", false
+	}
+
+	return strings.Join([]string{canonical, strings.ToLower(params.Driver), params.Name, params.Prefix}, "\x00"), true
+}
+
+// pooledConnect returns a handle on the pooled connection of key, connecting it with InitEdgeStoreResult the
+// first time. Concurrent calls for the same key wait for that connection rather than making their own.
+func pooledConnect(key string, params *DBParameters, logger log.Logger) (storage.Provider, error) {
+	connPoolMutex.Lock()
+
+	conn, ok := connPool[key]
+	if !ok {
+		conn = &pooledConnection{key: key}
+		connPool[key] = conn
+	}
+
+	conn.refs++
+	connPoolMutex.Unlock()
+
+	conn.once.Do(func() {
+		var result *StoreResult
+
+		result, conn.err = InitEdgeStoreResult(params, logger)
+		if conn.err == nil {
+			conn.provider = result.Provider
+		}
+	})
+
+	if conn.err != nil {
+		// dropping the failed connection once its callers are done lets a later call try again
+		conn.release() // nolint:errcheck
+
+		return nil, conn.err
+	}
+
+	return &pooledProvider{Provider: conn.provider, conn: conn}, nil
+}
+
+// release drops a handle on the connection, closing its provider and removing it from the pool with the last.
+func (c *pooledConnection) release() error {
+	connPoolMutex.Lock()
+
+	c.refs--
+	last := c.refs == 0
+
+	if last && connPool[c.key] == c {
+		delete(connPool, c.key)
+	}
+
+	connPoolMutex.Unlock()
+
+	if !last || c.provider == nil {
+		return nil
+	}
+
+	return c.provider.Close()
+}
+
+// pooledProvider is a handle on a pooled connection.
+type pooledProvider struct {
+	storage.Provider
+	conn      *pooledConnection
+	closeOnce sync.Once
+}
+
+// Close releases the handle, closing the shared provider if it was the last one. Closing a handle again does
+// nothing.
+func (p *pooledProvider) Close() error {
+	var err error
+
+	p.closeOnce.Do(func() {
+		err = p.conn.release()
+	})
+
+	return err
+}
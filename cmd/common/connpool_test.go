@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseConnectionPool(t *testing.T) {
+	setup := func(t *testing.T) *connectionCounter {
+		t.Helper()
+
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		registerTestFactory(t, "pooled", counter.connect)
+
+		UseConnectionPool(true)
+		t.Cleanup(func() { UseConnectionPool(false) })
+
+		return counter
+	}
+
+	t.Run("calls for the same url share a provider", func(t *testing.T) {
+		counter := setup(t)
+
+		first, err := InitEdgeStore(&DBParameters{URL: "pooled://Localhost", Prefix: "app"}, logger)
+		require.NoError(t, err)
+
+		second, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+		require.NoError(t, err)
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+
+		s, err := first.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		s, err = second.OpenStore("store")
+		require.NoError(t, err)
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+
+		require.NoError(t, first.Close())
+		require.NoError(t, first.Close())
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+
+		require.NoError(t, second.Close())
+		require.Equal(t, [2]int{1, 1}, counter.counts())
+
+		third, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+		require.NoError(t, err)
+		require.Equal(t, [2]int{2, 1}, counter.counts())
+		require.NoError(t, third.Close())
+	})
+
+	t.Run("other prefixes connect on their own", func(t *testing.T) {
+		counter := setup(t)
+
+		first, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+		require.NoError(t, err)
+
+		second, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "other"}, logger)
+		require.NoError(t, err)
+		require.Equal(t, [2]int{2, 0}, counter.counts())
+
+		require.NoError(t, first.Close())
+		require.NoError(t, second.Close())
+		require.Equal(t, [2]int{2, 2}, counter.counts())
+	})
+
+	t.Run("failed connections are not kept", func(t *testing.T) {
+		setup(t)
+
+		registerTestFactory(t, "pooled", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, backoff.Permanent(errors.New("unreachable"))
+		})
+
+		_, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+		require.Error(t, err)
+
+		calls := recordingFactory(t, "pooled")
+
+		p, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+		require.NoError(t, err)
+		require.Len(t, *calls, 1)
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		registerTestFactory(t, "pooled", counter.connect)
+
+		for i := 0; i < 2; i++ {
+			_, err := InitEdgeStore(&DBParameters{URL: "pooled://localhost", Prefix: "app"}, logger)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, [2]int{2, 0}, counter.counts())
+	})
+}
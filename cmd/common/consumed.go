@@ -0,0 +1,56 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// nolint:gochecknoglobals
+var (
+	consumedEnvKeys      = map[string]bool{}
+	consumedEnvKeysMutex sync.Mutex
+)
+
+// ConsumedEnvKeys returns, sorted, the environment variables that DBParams resolved a setting from during this
+// run, that is those set to a non-empty value for a setting whose flag was not given. Settings read from their
+// flag or left to their default are not listed. Variables set by DatabaseConfigFileEnvKey or
+// DatabaseProfileEnvKey count as read from the environment.
+func ConsumedEnvKeys() []string {
+	consumedEnvKeysMutex.Lock()
+	defer consumedEnvKeysMutex.Unlock()
+
+	keys := make([]string, 0, len(consumedEnvKeys))
+	for key := range consumedEnvKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// recordConsumedEnvKeys adds the environment variables that the settings of cmd were read from to
+// ConsumedEnvKeys, following the precedence of cmdutils: a flag that was given wins over its variable.
+func recordConsumedEnvKeys(cmd *cobra.Command) {
+	consumedEnvKeysMutex.Lock()
+	defer consumedEnvKeysMutex.Unlock()
+
+	for _, setting := range dbFlags() {
+		if cmd.Flags().Changed(setting.name) {
+			continue
+		}
+
+		if value, ok := os.LookupEnv(setting.envKey); ok && value != "" {
+			consumedEnvKeys[setting.envKey] = true
+		}
+	}
+}
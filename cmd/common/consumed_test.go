@@ -0,0 +1,49 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumedEnvKeys(t *testing.T) {
+	resetConsumedEnvKeys := func() {
+		consumedEnvKeysMutex.Lock()
+		defer consumedEnvKeysMutex.Unlock()
+
+		consumedEnvKeys = map[string]bool{}
+	}
+
+	resetConsumedEnvKeys()
+	defer resetConsumedEnvKeys()
+
+	setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app", Timeout: 30})
+	defer unsetEnv(t)
+	require.NoError(t, os.Setenv(DatabaseStoreNameEnvKey, ""))
+	require.NoError(t, os.Setenv(DatabaseNameEnvKey, "ignored"))
+
+	cmd := &cobra.Command{}
+	Flags(cmd)
+	require.NoError(t, cmd.Flags().Set(DatabasePrefixFlagName, "flagged"))
+	require.NoError(t, cmd.Flags().Set(DatabaseNameFlagName, "adapter"))
+
+	require.Empty(t, ConsumedEnvKeys())
+
+	params, err := DBParams(cmd)
+	require.NoError(t, err)
+	require.Equal(t, "flagged", params.Prefix)
+
+	keys := ConsumedEnvKeys()
+	require.Equal(t, []string{DatabaseTimeoutEnvKey, DatabaseURLEnvKey}, keys)
+	require.NotContains(t, keys, DatabasePrefixEnvKey)
+	require.NotContains(t, keys, DatabaseNameEnvKey)
+	require.NotContains(t, keys, DatabaseStoreNameEnvKey)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+const (
+	// diagnosticsOutputFlagName is the flag of the diagnostics command giving the file to write the bundle to.
+	diagnosticsOutputFlagName = "output"
+	diagnosticsOutputDefault  = "db-diagnostics.json"
+	// diagnosticsStoreFlagName is the flag of the diagnostics command naming the stores to open.
+	diagnosticsStoreFlagName = "store"
+	diagnosticsFileMode      = 0o600
+)
+
+// diagnosticsBundle is the document written by the diagnostics command.
+type diagnosticsBundle struct {
+	Config           *ResolvedDBConfig  `json:"config"`
+	Driver           string             `json:"driver"`
+	SupportedDrivers []string           `json:"supported_drivers"`
+	Connectivity     diagnosticsCheck   `json:"connectivity"`
+	RoundTrip        diagnosticsCheck   `json:"round_trip"`
+	Stores           []diagnosticsStore `json:"stores"`
+}
+
+// diagnosticsCheck is the outcome of a step of the diagnostics command.
+type diagnosticsCheck struct {
+	OK      bool   `json:"ok"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type diagnosticsStore struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// BuildDiagnosticsCommand builds a command that writes a diagnostics bundle of the storage configured with the
+// Flags as JSON to the file given with --output: the ResolvedConfig, the driver, the SupportedDrivers, whether
+// the storage could be connected to and passed a HealthCheck, the latency of MeasureRoundTrip, and whether the
+// store name and the stores given with --store could be opened. Failed steps are recorded in the bundle rather
+// than failing the command, and the passwords of the URLs are masked, errors included, so that the bundle can be
+// attached to a support request.
+func BuildDiagnosticsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diagnostics",
+		Short: "Write a database diagnostics bundle",
+		Long:  "Write the configuration and the connectivity of the configured database to a JSON file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := ResolvedConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			params, err := DBParams(cmd)
+			if err != nil {
+				return err
+			}
+
+			output, err := cmd.Flags().GetString(diagnosticsOutputFlagName)
+			if err != nil {
+				return err
+			}
+
+			stores, err := cmd.Flags().GetStringArray(diagnosticsStoreFlagName)
+			if err != nil {
+				return err
+			}
+
+			bundle := collectDiagnostics(cmd.Context(), config, params, stores, packageLogger())
+
+			if err = writeDiagnostics(output, bundle); err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "diagnostics written to %s\n", output)
+
+			return err
+		},
+	}
+
+	Flags(cmd)
+	cmd.Flags().String(diagnosticsOutputFlagName, diagnosticsOutputDefault, "The file to write the bundle to.")
+	cmd.Flags().StringArray(diagnosticsStoreFlagName, nil,
+		"A store to open, in addition to the store name. Can be repeated.")
+
+	return cmd
+}
+
+func collectDiagnostics(ctx context.Context, config *ResolvedDBConfig, params *DBParameters, stores []string,
+	logger log.Logger) *diagnosticsBundle {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	bundle := &diagnosticsBundle{
+		Config:           config,
+		Driver:           config.DriverScheme,
+		SupportedDrivers: SupportedDrivers(),
+		Stores:           []diagnosticsStore{},
+	}
+
+	started := time.Now()
+
+	provider, err := InitEdgeStore(params, logger)
+	if err == nil {
+		defer provider.Close() // nolint:errcheck
+
+		healthCtx, cancel := OperationContext(ctx, params)
+		err = HealthCheck(healthCtx, provider)
+
+		cancel()
+	}
+
+	bundle.Connectivity = diagnosticsResult(params, time.Since(started), err)
+
+	if provider == nil {
+		bundle.RoundTrip = diagnosticsResult(params, 0, fmt.Errorf("not connected"))
+
+		return bundle
+	}
+
+	latency, err := MeasureRoundTrip(ctx, provider, params)
+	bundle.RoundTrip = diagnosticsResult(params, latency, err)
+
+	bundle.Stores = diagnoseStores(provider, params, stores)
+
+	return bundle
+}
+
+// diagnoseStores opens params.StoreName, if set, and the named stores on p once each.
+func diagnoseStores(p storage.Provider, params *DBParameters, names []string) []diagnosticsStore {
+	if params.StoreName != "" {
+		names = append([]string{params.StoreName}, names...)
+	}
+
+	results := []diagnosticsStore{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		result := diagnosticsStore{Name: name, OK: true}
+
+		if _, err := p.OpenStore(name); err != nil {
+			result.OK, result.Error = false, redactSecrets(params, err.Error())
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func diagnosticsResult(params *DBParameters, latency time.Duration, err error) diagnosticsCheck {
+	if err != nil {
+		return diagnosticsCheck{Error: redactSecrets(params, err.Error())}
+	}
+
+	return diagnosticsCheck{OK: true, Latency: latency.String()}
+}
+
+// redactSecrets replaces the passwords of the URLs of params in s, as maskURL does in the URLs themselves.
+func redactSecrets(params *DBParameters, s string) string {
+	if maskingDisabled() {
+		return s
+	}
+
+	for _, dbURL := range []string{params.URL, params.ReplicaURL} {
+		_, _, password, _, ok := splitUserInfo(dbURL)
+		if !ok || password == "" {
+			continue
+		}
+
+		s = strings.ReplaceAll(s, password, "***")
+
+		// drivers taking a raw DSN get the password unescaped by decodeUserInfo
+		if decoded, err := url.PathUnescape(password); err == nil {
+			s = strings.ReplaceAll(s, decoded, "***")
+		}
+	}
+
+	return s
+}
+
+func writeDiagnostics(path string, bundle *diagnosticsBundle) error {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("write diagnostics: %w", err)
+	}
+
+	if err = ioutil.WriteFile(path, data, diagnosticsFileMode); err != nil {
+		return fmt.Errorf("write diagnostics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDotEnvPath is the file loaded by LoadDotEnv when no path is given.
+const DefaultDotEnvPath = ".env"
+
+// LoadDotEnv sets the KEY=VALUE lines of the file at path into the environment, so that DBParams and the other
+// flag readers see them. Variables that are already set are not overwritten, blank lines and lines starting
+// with "#" are ignored, and values may be quoted. An empty path loads DefaultDotEnvPath, which may be missing;
+// an explicitly given file must exist.
+func LoadDotEnv(path string) error {
+	optional := path == ""
+	if optional {
+		path = DefaultDotEnvPath
+	}
+
+	values, err := readDotEnv(path, optional)
+	if err != nil {
+		return err
+	}
+
+	return setUnsetEnv(path, values)
+}
+
+// ExportEnv returns the KEY=VALUE lines of the environment variables configuring params through DBParams, for
+// sourcing into a shell or loading with LoadDotEnv to reproduce an environment. Only the settings that are set
+// are listed, and values the shell would split or expand are single-quoted. The passwords of the URLs are masked
+// as in the logs unless includeSecrets is true.
+func ExportEnv(params *DBParameters, includeSecrets bool) []string {
+	dbURL, replicaURL := maskURL(params.URL), maskURL(params.ReplicaURL)
+	if includeSecrets {
+		dbURL, replicaURL = params.URL, params.ReplicaURL
+	}
+
+	var lines []string
+
+	for _, v := range exportedEnv(params, dbURL, replicaURL) {
+		if v.value != "" {
+			lines = append(lines, v.key+"="+shellQuote(v.value))
+		}
+	}
+
+	return lines
+}
+
+// exportedEnv returns the environment variables of params, empty for the settings that are not set.
+func exportedEnv(params *DBParameters, dbURL, replicaURL string) []dotEnvValue {
+	var timeout, totalTimeout string
+
+	if params.Timeout > 0 {
+		// a duration is read the same whatever the timeout unit
+		timeout = (time.Duration(params.Timeout) * time.Second).String()
+	}
+
+	if params.TotalTimeout > 0 {
+		totalTimeout = strconv.FormatUint(params.TotalTimeout, 10)
+	}
+
+	statusCodes := make([]string, len(params.RetryStatusCodes))
+	for i, code := range params.RetryStatusCodes {
+		statusCodes[i] = strconv.Itoa(code)
+	}
+
+	return []dotEnvValue{
+		{DatabaseURLEnvKey, dbURL}, {DatabaseReplicaURLEnvKey, replicaURL},
+		{DatabaseDriverEnvKey, params.Driver}, {DatabaseNameEnvKey, params.Name},
+		{DatabasePrefixEnvKey, params.Prefix}, {DatabasePrefixPositionEnvKey, params.PrefixPosition},
+		{DatabaseStoreNameEnvKey, params.StoreName}, {DatabaseHealthStoreEnvKey, params.HealthStore},
+		{DatabasePingQueryEnvKey, params.PingQuery},
+		{DatabaseTimeoutEnvKey, timeout}, {DatabaseTotalTimeoutEnvKey, totalTimeout},
+		{DatabaseRetryJitterEnvKey, exportedBool(params.RetryJitter)},
+		{DatabaseRetryMinBackoffEnvKey, exportedDuration(params.RetryMinBackoff)},
+		{DatabaseRetryMaxBackoffEnvKey, exportedDuration(params.RetryMaxBackoff)},
+		{DatabaseRetryStatusCodesEnvKey, strings.Join(statusCodes, ",")},
+		{DatabaseMaxValueSizeEnvKey, exportedInt(params.MaxValueSize)},
+		{DatabaseMaxStoresEnvKey, exportedInt(params.MaxStores)},
+		{DatabaseAllowClearEnvKey, exportedBool(params.AllowClear)},
+		{DatabaseCompatModeEnvKey, params.CompatMode},
+		{DatabaseStartupLogLevelEnvKey, params.StartupLogLevel},
+		{DatabaseConnectLogEnvKey, exportedBool(params.ConnectLog)}, {DatabaseAppNameEnvKey, params.AppName},
+		{DatabaseConnMaxLifetimeEnvKey, exportedDuration(params.ConnMaxLifetime)},
+		{DatabaseConnMaxIdleTimeEnvKey, exportedDuration(params.ConnMaxIdleTime)},
+		{DatabaseCloseTimeoutEnvKey, exportedDuration(params.CloseTimeout)},
+		// CACertPool unescapes the newlines of inline certificates
+		{DatabaseTLSCACertsEnvKey, strings.ReplaceAll(strings.Join(params.TLSCACerts, ","), "\n", `\n`)},
+	}
+}
+
+func exportedBool(b bool) string {
+	if !b {
+		return ""
+	}
+
+	return "true"
+}
+
+func exportedInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(n)
+}
+
+func exportedDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+// shellQuote single-quotes value unless it is made of characters the shell takes literally.
+func shellQuote(value string) string {
+	unsafe := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("_@%+=:,./-", r))
+	})
+	if unsafe < 0 {
+		return value
+	}
+
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// LoadConfigFiles merges the dotenv files of the comma-separated list paths in order, later files overriding
+// earlier ones, and sets the result into the environment as LoadDotEnv does, so that variables already set
+// still take precedence. A file must exist unless its path ends with "?".
+func LoadConfigFiles(paths string) error {
+	merged := map[string]string{}
+
+	var keys []string
+
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		optional := strings.HasSuffix(path, "?")
+		path = strings.TrimSuffix(path, "?")
+
+		values, err := readDotEnv(path, optional)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			if _, seen := merged[v.key]; !seen {
+				keys = append(keys, v.key)
+			}
+
+			merged[v.key] = v.value
+		}
+	}
+
+	values := make([]dotEnvValue, len(keys))
+	for i, key := range keys {
+		values[i] = dotEnvValue{key: key, value: merged[key]}
+	}
+
+	return setUnsetEnv(paths, values)
+}
+
+// LoadConfigDir sets into the environment, as LoadDotEnv does, the database variables that have a file named
+// after them in dir, with the content of the file as the value less its trailing newline. This reads the
+// configuration that Kubernetes projects into files. Variables without a file are left alone; dir itself must
+// exist.
+func LoadConfigDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("load config dir: %w", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("load config dir: %s is not a directory", dir)
+	}
+
+	var values []dotEnvValue
+
+	for _, flag := range dbFlags() {
+		data, readErr := ioutil.ReadFile(filepath.Join(dir, flag.envKey)) // nolint:gosec
+		if errors.Is(readErr, os.ErrNotExist) {
+			continue
+		}
+
+		if readErr != nil {
+			return fmt.Errorf("load config dir: %w", readErr)
+		}
+
+		values = append(values, dotEnvValue{key: flag.envKey, value: strings.TrimRight(string(data), "\r\n")})
+	}
+
+	return setUnsetEnv(dir, values)
+}
+
+type dotEnvValue struct {
+	key, value string
+}
+
+// readDotEnv returns the variables set by the file at path, in file order. A missing optional file sets none.
+func readDotEnv(path string, optional bool) ([]dotEnvValue, error) {
+	f, err := os.Open(path) // nolint:gosec
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("load dotenv %s: %w", path, err)
+	}
+
+	defer f.Close() // nolint:errcheck
+
+	var values []dotEnvValue
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok, parseErr := parseDotEnvLine(scanner.Text())
+		if parseErr != nil {
+			return nil, fmt.Errorf("load dotenv %s: line %d: %w", path, n, parseErr)
+		}
+
+		if ok {
+			values = append(values, dotEnvValue{key: key, value: value})
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load dotenv %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// setUnsetEnv sets the values loaded from source whose variable is not already set in the environment.
+func setUnsetEnv(source string, values []dotEnvValue) error {
+	for _, v := range values {
+		if _, set := os.LookupEnv(v.key); set {
+			packageLogger().Debugf("dotenv %s: %s is already set in the environment, ignoring the file value",
+				source, v.key)
+
+			continue
+		}
+
+		if err := os.Setenv(v.key, v.value); err != nil {
+			return fmt.Errorf("load dotenv %s: set %s: %w", source, v.key, err)
+		}
+	}
+
+	return nil
+}
+
+// parseDotEnvLine returns the variable set by line, or false if line is blank or a comment.
+func parseDotEnvLine(line string) (string, string, bool, error) {
+	const keyValueParts = 2
+
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", keyValueParts)
+	key := strings.TrimSpace(parts[0])
+
+	if len(parts) != keyValueParts || key == "" {
+		return "", "", false, fmt.Errorf("expected KEY=VALUE, got %q", line)
+	}
+
+	value := strings.TrimSpace(parts[1])
+
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return key, value, true, nil
+}
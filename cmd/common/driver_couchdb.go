@@ -0,0 +1,35 @@
+//go:build !nocouchdb
+// +build !nocouchdb
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"github.com/hyperledger/aries-framework-go-ext/component/storage/couchdb"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// nolint:gochecknoinits
+func init() {
+	registerDriver("couchdb", newCouchDBProvider, Capabilities{Query: true})
+
+	httpTransportDrivers["couchdb"] = true
+	prefixingDrivers["couchdb"] = true
+	legacyErrorDrivers["couchdb"] = true
+
+	// the driver connects over plain HTTP unless the scheme selects HTTPS
+	defaultPorts["couchdb"] = "80"
+	defaultPorts["couchdb+http"] = "80"
+	defaultPorts["couchdb+https"] = "443"
+}
+
+// newCouchDBProvider creates the CouchDB provider. The driver version in use does not take a client identifier for
+// params.AppName.
+func newCouchDBProvider(dbURL string, params *DBParameters) (storage.Provider, error) {
+	return couchdb.NewProvider(dbURL, couchdb.WithDBPrefix(params.Prefix))
+}
@@ -0,0 +1,84 @@
+//go:build !nomysql
+// +build !nomysql
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"database/sql"
+	"fmt"
+
+	// registers the database/sql driver of the handle opened by withMySQLDB, which the storage driver uses too
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/hyperledger/aries-framework-go-ext/component/storage/mysql"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// nolint:gochecknoinits
+func init() {
+	registerDriver("mysql", newMySQLProvider, Capabilities{Query: true})
+
+	namedDatabaseDrivers["mysql"] = true
+	prefixingDrivers["mysql"] = true
+	rawCredentialDrivers["mysql"] = true
+	legacyErrorDrivers["mysql"] = true
+	defaultPorts["mysql"] = "3306"
+	maxStoreNameLengths["mysql"] = mysqlMaxIdentifierLength
+}
+
+// mysqlMaxIdentifierLength is the longest database or table name accepted by MySQL.
+const mysqlMaxIdentifierLength = 64
+
+// newMySQLProvider creates the MySQL provider. The MySQL client in use cannot send connection attributes and keeps
+// its connection pool private, so the driver has neither the AppName nor the ConnLifetimes capability and
+// DBParameters.AppName, ConnMaxLifetime and ConnMaxIdleTime are rejected for it.
+func newMySQLProvider(dbURL string, params *DBParameters) (storage.Provider, error) {
+	p, err := mysql.NewProvider(dbURL, mysql.WithDBPrefix(params.Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	return withMySQLDB(p, dbURL)
+}
+
+// withMySQLDB returns p along with a database handle of its own on the server of dbURL, which the storage driver
+// doesn't expose, for RawSQLDB and the health checks. The handle has its own connection pool, which is only used
+// for them. p is closed if the handle cannot be opened.
+func withMySQLDB(p storage.Provider, dbURL string) (storage.Provider, error) {
+	db, err := sql.Open("mysql", dbURL)
+	if err != nil {
+		return nil, closeOnFailure(p, fmt.Errorf("open mysql database handle: %w", err))
+	}
+
+	return &mysqlProvider{Provider: p, db: db}, nil
+}
+
+// mysqlProvider is a MySQL provider with the database handle opened by withMySQLDB.
+type mysqlProvider struct {
+	storage.Provider
+	db *sql.DB
+}
+
+func (p *mysqlProvider) DB() *sql.DB {
+	return p.db
+}
+
+// Close closes the provider, then the database handle.
+func (p *mysqlProvider) Close() error {
+	var errs multiError
+
+	if err := p.Provider.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := p.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close mysql database handle: %w", err))
+	}
+
+	return errs.errorOrNil()
+}
@@ -0,0 +1,59 @@
+//go:build !nomysql
+// +build !nomysql
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLDB(t *testing.T) {
+	t.Run("raw database handle", func(t *testing.T) {
+		p, err := withMySQLDB(mem.NewProvider(), "root:secret@tcp(localhost:3306)/")
+		require.NoError(t, err)
+
+		db, err := RawSQLDB(p)
+		require.NoError(t, err)
+		require.NotNil(t, db)
+
+		require.NoError(t, p.Close())
+		require.EqualError(t, db.Ping(), "sql: database is closed")
+	})
+
+	t.Run("health checks run the ping query on the handle", func(t *testing.T) {
+		// nothing listens on port 1, so the query fails to connect instead of the health store being read
+		registerTestFactory(t, "mysqlhandle", func(string, *DBParameters) (storage.Provider, error) {
+			return withMySQLDB(mem.NewProvider(), "root:secret@tcp(127.0.0.1:1)/")
+		})
+
+		p, err := BuildProvider(&DBParameters{URL: "mysqlhandle://", PingQuery: "SELECT /* proxy */ 1"}, logger)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, p.Close()) }()
+
+		err = HealthCheck(context.Background(), p)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "health check: ping query: ")
+		require.Contains(t, err.Error(), "connection refused")
+	})
+
+	t.Run("invalid DSN", func(t *testing.T) {
+		backend := &mockProvider{}
+
+		_, err := withMySQLDB(backend, "localhost:3306")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open mysql database handle: invalid DSN")
+		require.True(t, backend.closed)
+	})
+}
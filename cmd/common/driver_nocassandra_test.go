@@ -0,0 +1,26 @@
+//go:build !cassandra
+// +build !cassandra
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassandraExcluded(t *testing.T) {
+	require.NotContains(t, SupportedDrivers(), "cassandra")
+
+	_, err := InitEdgeStore(&DBParameters{URL: "cassandra://localhost:9042", Timeout: 1}, logger)
+	require.EqualError(t, err, "unsupported storage driver: cassandra")
+
+	_, err = DriverCapabilities("cassandra")
+	require.EqualError(t, err, "unsupported storage driver: cassandra")
+}
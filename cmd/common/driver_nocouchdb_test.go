@@ -0,0 +1,26 @@
+//go:build nocouchdb
+// +build nocouchdb
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouchDBExcluded(t *testing.T) {
+	require.NotContains(t, SupportedDrivers(), "couchdb")
+
+	_, err := InitEdgeStore(&DBParameters{URL: "couchdb://localhost:5984", Timeout: 1}, logger)
+	require.EqualError(t, err, "unsupported storage driver: couchdb")
+
+	_, err = DriverCapabilities("couchdb")
+	require.EqualError(t, err, "unsupported storage driver: couchdb")
+}
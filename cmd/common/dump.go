@@ -0,0 +1,106 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+)
+
+// dumpLimitFlagName is the flag of the dump command giving the maximum number of entries to write.
+const dumpLimitFlagName = "limit"
+
+// dumpEncodingBase64 marks the dumped values that are not valid UTF-8 text.
+const dumpEncodingBase64 = "base64"
+
+// dumpEntry is a line written by the dump command.
+type dumpEntry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// errDumpLimit stops the iteration of dumpStore once the limit is reached.
+var errDumpLimit = errors.New("dump limit reached")
+
+// BuildDBDumpCommand builds a command that connects to the storage configured with the Flags and writes the
+// enumerable entries of the store given with the store name flag to stdout as JSON lines. Values that are not
+// valid UTF-8 are base64 encoded and marked with "encoding": "base64". --limit bounds the number of entries.
+func BuildDBDumpCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump a store",
+		Long:  "Write the entries of a store of the configured database to stdout as JSON lines",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := DBParams(cmd)
+			if err != nil {
+				return err
+			}
+
+			limit, err := cmd.Flags().GetInt(dumpLimitFlagName)
+			if err != nil {
+				return err
+			}
+
+			provider, err := InitEdgeStore(params, packageLogger())
+			if err != nil {
+				return err
+			}
+
+			defer provider.Close() // nolint:errcheck
+
+			store, err := provider.OpenStore(params.StoreName)
+			if err != nil {
+				return fmt.Errorf("open store %s: %w", params.StoreName, err)
+			}
+
+			return dumpStore(cmd.Context(), cmd.OutOrStdout(), store, limit)
+		},
+	}
+
+	Flags(cmd)
+	cmd.Flags().Int(dumpLimitFlagName, 0, "The maximum number of entries to dump, all of them if 0.")
+
+	return cmd
+}
+
+func dumpStore(ctx context.Context, out io.Writer, store storage.Store, limit int) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	encoder := json.NewEncoder(out)
+	dumped := 0
+
+	err := ForEach(ctx, store, func(key string, value []byte) error {
+		if limit > 0 && dumped == limit {
+			return errDumpLimit
+		}
+
+		entry := dumpEntry{Key: key, Value: string(value)}
+		if !utf8.Valid(value) {
+			entry.Value, entry.Encoding = base64.StdEncoding.EncodeToString(value), dumpEncodingBase64
+		}
+
+		dumped++
+
+		return encoder.Encode(entry)
+	})
+	if err != nil && !errors.Is(err, errDumpLimit) {
+		return fmt.Errorf("dump store: %w", err)
+	}
+
+	return nil
+}
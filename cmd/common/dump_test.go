@@ -0,0 +1,85 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDBDumpCommand(t *testing.T) {
+	seed := func(t *testing.T) {
+		t.Helper()
+
+		p := mem.NewProvider()
+
+		store, err := p.OpenStore("entries")
+		require.NoError(t, err)
+		require.NoError(t, store.Put("alice", []byte(`{"name":"Alice"}`), EntryTag))
+		require.NoError(t, store.Put("bin", []byte{0xff, 0x00, 0x01}, EntryTag))
+		require.NoError(t, store.Put("hidden", []byte("not tagged")))
+
+		registerTestDriver(t, "seeded", p)
+	}
+
+	run := func(t *testing.T, args ...string) ([]string, error) {
+		t.Helper()
+
+		var out bytes.Buffer
+
+		cmd := BuildDBDumpCommand()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{
+			"--" + DatabaseURLFlagName, "seeded://", "--" + DatabasePrefixFlagName, "app",
+			"--" + DatabaseStoreNameFlagName, "entries", "--" + DatabaseTimeoutFlagName, "1",
+		}, args...))
+
+		err := cmd.Execute()
+
+		return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"), err
+	}
+
+	t.Run("dumps every entry", func(t *testing.T) {
+		seed(t)
+
+		lines, err := run(t)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			`{"key":"alice","value":"{\"name\":\"Alice\"}"}`,
+			`{"key":"bin","value":"/wAB","encoding":"base64"}`,
+		}, lines)
+	})
+
+	t.Run("respects the limit", func(t *testing.T) {
+		seed(t)
+
+		lines, err := run(t, "--"+dumpLimitFlagName, "1")
+		require.NoError(t, err)
+		require.Len(t, lines, 1)
+
+		var entry dumpEntry
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		require.Contains(t, []string{"alice", "bin"}, entry.Key)
+	})
+
+	t.Run("configuration error", func(t *testing.T) {
+		var out bytes.Buffer
+
+		cmd := BuildDBDumpCommand()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"--" + DatabasePrefixFlagName, "app"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Equal(t, ErrCodeMissingURL, ErrorCode(err))
+	})
+}
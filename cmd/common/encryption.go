@@ -0,0 +1,168 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// WithEncryption encrypts values with AES-GCM under key before they reach the backend and decrypts them on Get,
+// GetBulk and Query. Keys and tags are stored in the clear, and each value is bound to its key so that it cannot
+// be moved to another key undetected. The key must be 16, 24 or 32 bytes long; any other length fails
+// BuildProvider rather than storing values unencrypted.
+func WithEncryption(key []byte) BuildOption {
+	return func(opts *buildOptions) {
+		aead, err := newAEAD(key)
+		if err != nil {
+			opts.onConnect = append(opts.onConnect, func(storage.Provider) error {
+				return err
+			})
+
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &encryptedStore{Store: s, aead: aead}
+			})
+		})
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	return aead, nil
+}
+
+type encryptedStore struct {
+	storage.Store
+	aead cipher.AEAD
+}
+
+func (s *encryptedStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	sealed, err := s.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, sealed, tags...)
+}
+
+func (s *encryptedStore) Get(key string) ([]byte, error) {
+	sealed, err := s.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(key, sealed)
+}
+
+func (s *encryptedStore) GetBulk(keys ...string) ([][]byte, error) {
+	values, err := s.Store.GetBulk(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sealed := range values {
+		if sealed == nil {
+			continue
+		}
+
+		if values[i], err = s.open(keys[i], sealed); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func (s *encryptedStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptingIterator{Iterator: iterator, store: s}, nil
+}
+
+func (s *encryptedStore) Batch(operations []storage.Operation) error {
+	sealed := make([]storage.Operation, len(operations))
+
+	for i, op := range operations {
+		sealed[i] = op
+
+		if op.Value == nil {
+			continue
+		}
+
+		var err error
+		if sealed[i].Value, err = s.seal(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Batch(sealed)
+}
+
+// seal returns the nonce followed by the ciphertext of value, authenticated together with key.
+func (s *encryptedStore) seal(key string, value []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return s.aead.Seal(nonce, nonce, value, []byte(key)), nil
+}
+
+func (s *encryptedStore) open(key string, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("decrypt %s: value too short", truncateKey(key))
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+
+	value, err := s.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", truncateKey(key), err)
+	}
+
+	return value, nil
+}
+
+type decryptingIterator struct {
+	storage.Iterator
+	store *encryptedStore
+}
+
+func (i *decryptingIterator) Value() ([]byte, error) {
+	key, err := i.Iterator.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := i.Iterator.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	return i.store.open(key, sealed)
+}
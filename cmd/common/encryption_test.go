@@ -0,0 +1,74 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plaintext := []byte("account secret")
+
+	backend := mem.NewProvider()
+	registerTestDriver(t, "encrypted", backend)
+
+	p, err := BuildProvider(&DBParameters{URL: "encrypted://test"}, logger, WithEncryption(key), WithEntryTagging())
+	require.NoError(t, err)
+
+	s, err := p.OpenStore("accounts")
+	require.NoError(t, err)
+
+	raw, err := backend.OpenStore("accounts")
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		require.NoError(t, s.Put("alice", plaintext))
+
+		value, err := s.Get("alice")
+		require.NoError(t, err)
+		require.Equal(t, plaintext, value)
+
+		stored, err := raw.Get("alice")
+		require.NoError(t, err)
+		require.NotEqual(t, plaintext, stored)
+		require.False(t, bytes.Contains(stored, plaintext))
+	})
+
+	t.Run("batch, bulk reads and queries", func(t *testing.T) {
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "bob", Value: []byte("b")}, {Key: "alice"}}))
+
+		values, err := s.GetBulk("bob", "alice")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("b"), nil}, values)
+
+		snap := snapshotValues(t, s)
+		require.Equal(t, map[string][]byte{"bob": []byte("b")}, snap)
+	})
+
+	t.Run("value moved to another key is rejected", func(t *testing.T) {
+		stored, err := raw.Get("bob")
+		require.NoError(t, err)
+		require.NoError(t, raw.Put("carol", stored))
+
+		_, err = s.Get("carol")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decrypt carol")
+	})
+
+	t.Run("wrong key length fails closed", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithEncryption([]byte("short")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid encryption key")
+		require.Nil(t, p)
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// EnvAlias is an environment variable accepted in place of one read by DBParams.
+type EnvAlias struct {
+	// Key is the name of the alias variable.
+	Key string
+	// Deprecated makes DBParams log a warning when the value is taken from this alias.
+	Deprecated bool
+}
+
+// nolint:gochecknoglobals
+var (
+	envAliases      = map[string][]EnvAlias{}
+	envAliasesMutex sync.RWMutex
+)
+
+// RegisterEnvAliases makes DBParams accept aliases in place of envKey, such as DatabaseURLEnvKey, while teams move
+// to a new naming. When envKey is unset, the aliases are checked in the order they were registered and the first
+// one set supplies the value: it is copied to envKey, like the values loaded by LoadDotEnv.
+func RegisterEnvAliases(envKey string, aliases ...EnvAlias) {
+	envAliasesMutex.Lock()
+	defer envAliasesMutex.Unlock()
+
+	envAliases[envKey] = append(envAliases[envKey], aliases...)
+}
+
+// AliasEnvKeys returns the alias keys registered for envKey, in priority order.
+func AliasEnvKeys(envKey string) []string {
+	envAliasesMutex.RLock()
+	defer envAliasesMutex.RUnlock()
+
+	keys := make([]string, len(envAliases[envKey]))
+
+	for i, alias := range envAliases[envKey] {
+		keys[i] = alias.Key
+	}
+
+	return keys
+}
+
+func applyEnvAliases() error {
+	envAliasesMutex.RLock()
+	defer envAliasesMutex.RUnlock()
+
+	envKeys := make([]string, 0, len(envAliases))
+
+	for envKey := range envAliases {
+		envKeys = append(envKeys, envKey)
+	}
+
+	sort.Strings(envKeys)
+
+	for _, envKey := range envKeys {
+		if _, set := os.LookupEnv(envKey); set {
+			continue
+		}
+
+		for _, alias := range envAliases[envKey] {
+			value, set := os.LookupEnv(alias.Key)
+			if !set {
+				continue
+			}
+
+			if alias.Deprecated {
+				packageLogger().Warnf("environment variable %s is deprecated, use %s instead", alias.Key, envKey)
+			}
+
+			if err := os.Setenv(envKey, value); err != nil {
+				return fmt.Errorf("set %s from alias %s: %w", envKey, alias.Key, err)
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
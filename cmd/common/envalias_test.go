@@ -0,0 +1,111 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+)
+
+func TestRegisterEnvAliases(t *testing.T) {
+	const (
+		currentKey    = "SANDBOX_DB_URL"
+		deprecatedKey = "DATABASE_LEGACY_URL"
+	)
+
+	registerTestEnvAliases(t, DatabaseURLEnvKey,
+		EnvAlias{Key: currentKey}, EnvAlias{Key: deprecatedKey, Deprecated: true})
+	require.Equal(t, []string{currentKey, deprecatedKey}, AliasEnvKeys(DatabaseURLEnvKey))
+
+	mockLogger := &mocklogger.MockLogger{}
+	SetPackageLogger(mockLogger)
+
+	defer SetPackageLogger(nil)
+
+	parse := func(t *testing.T, env map[string]string) *DBParameters {
+		t.Helper()
+
+		mockLogger.WarnLogContents = ""
+
+		require.NoError(t, os.Unsetenv(DatabaseURLEnvKey))
+		require.NoError(t, os.Setenv(DatabasePrefixEnvKey, "app"))
+
+		for key, value := range env {
+			require.NoError(t, os.Setenv(key, value))
+		}
+
+		t.Cleanup(func() {
+			for key := range env {
+				require.NoError(t, os.Unsetenv(key))
+			}
+
+			unsetEnv(t)
+		})
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+
+		return params
+	}
+
+	t.Run("canonical key wins", func(t *testing.T) {
+		params := parse(t, map[string]string{
+			DatabaseURLEnvKey: "mem://canonical", currentKey: "mem://current", deprecatedKey: "mem://deprecated",
+		})
+		require.Equal(t, "mem://canonical", params.URL)
+		require.Empty(t, mockLogger.WarnLogContents)
+	})
+
+	t.Run("first alias wins", func(t *testing.T) {
+		params := parse(t, map[string]string{currentKey: "mem://current", deprecatedKey: "mem://deprecated"})
+		require.Equal(t, "mem://current", params.URL)
+		require.Empty(t, mockLogger.WarnLogContents)
+	})
+
+	t.Run("deprecated alias", func(t *testing.T) {
+		params := parse(t, map[string]string{deprecatedKey: "mem://deprecated"})
+		require.Equal(t, "mem://deprecated", params.URL)
+		require.Contains(t, mockLogger.WarnLogContents,
+			"environment variable DATABASE_LEGACY_URL is deprecated, use DATABASE_URL instead")
+	})
+
+	t.Run("known in strict mode", func(t *testing.T) {
+		StrictEnv(true)
+		defer StrictEnv(false)
+
+		params := parse(t, map[string]string{deprecatedKey: "mem://deprecated"})
+		require.Equal(t, "mem://deprecated", params.URL)
+	})
+}
+
+func registerTestEnvAliases(t *testing.T, envKey string, aliases ...EnvAlias) {
+	t.Helper()
+
+	envAliasesMutex.Lock()
+	previous := envAliases[envKey]
+	envAliasesMutex.Unlock()
+
+	RegisterEnvAliases(envKey, aliases...)
+
+	t.Cleanup(func() {
+		envAliasesMutex.Lock()
+		defer envAliasesMutex.Unlock()
+
+		if previous == nil {
+			delete(envAliases, envKey)
+		} else {
+			envAliases[envKey] = previous
+		}
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// statusCoder is implemented by the errors of HTTP based drivers, such as the CouchDB client's.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// IsNotFound reports whether err means that the requested data does not exist, whichever driver returned it:
+// storage.ErrDataNotFound as returned by all the drivers for missing keys, sql.ErrNoRows leaked by the SQL
+// driver, or an HTTP 404 from the CouchDB client.
+func IsNotFound(err error) bool {
+	if errors.Is(err, storage.ErrDataNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+
+	var coder statusCoder
+
+	return errors.As(err, &coder) && coder.StatusCode() == http.StatusNotFound
+}
+
+// ErrConnectTimeout is matched by the error of InitEdgeStore and BuildProvider when connecting took longer than
+// the timeout allows, that is once the RetryExhaustedError is. Its message, "storage connection timed out", is
+// part of the error message and will not change, so that monitoring can match on it.
+var ErrConnectTimeout = errors.New("storage connection timed out")
+
+// RetryExhaustedError is wrapped in the error of InitEdgeStore and BuildProvider when every connection attempt
+// failed and the retries ran out, as opposed to an attempt failing with an error that is not retried, such as a
+// driver panic. Err is the error of the last attempt. It matches ErrConnectTimeout.
+type RetryExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	return fmt.Sprintf("%s, giving up after %d attempts: %s", ErrConnectTimeout, e.Attempts, e.Err)
+}
+
+// Is reports whether target is ErrConnectTimeout.
+func (e *RetryExhaustedError) Is(target error) bool {
+	return target == ErrConnectTimeout // nolint:errorlint
+}
+
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNotReady is matched by the errors of HealthCheck when the backend answered that it cannot serve requests
+// yet, with an HTTP 503 such as a starting CouchDB sends, as opposed to a probe that failed.
+var ErrNotReady = errors.New("storage not ready")
+
+// notReadyError is a probe error that matches ErrNotReady.
+type notReadyError struct {
+	err error
+}
+
+// notReady returns err as a notReadyError if it tells that the backend is not ready yet.
+func notReady(err error) error {
+	var coder statusCoder
+	if errors.As(err, &coder) && coder.StatusCode() == http.StatusServiceUnavailable {
+		return &notReadyError{err: err}
+	}
+
+	return err
+}
+
+func (e *notReadyError) Error() string {
+	return e.err.Error()
+}
+
+// Is reports whether target is ErrNotReady.
+func (e *notReadyError) Is(target error) bool {
+	return target == ErrNotReady // nolint:errorlint
+}
+
+func (e *notReadyError) Unwrap() error {
+	return e.err
+}
+
+// multiError aggregates several errors into one. errors.Is matches any of them.
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m multiError) errorOrNil() error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	return m
+}
+
+// Codes of the errors returned by DBParams and InitEdgeStore, for callers that need to tell failures apart
+// without matching messages.
+const (
+	ErrCodeMissingURL        = "MISSING_URL"
+	ErrCodeMissingPrefix     = "MISSING_PREFIX"
+	ErrCodeInvalidURL        = "INVALID_URL"
+	ErrCodeInvalidTimeout    = "INVALID_TIMEOUT"
+	ErrCodeInvalidConfig     = "INVALID_CONFIG"
+	ErrCodeUnsupportedDriver = "UNSUPPORTED_DRIVER"
+	ErrCodeConnectFailed     = "CONNECT_FAILED"
+)
+
+// CodedError is implemented by the errors carrying one of the ErrCode constants.
+type CodedError interface {
+	error
+	Code() string
+}
+
+// ErrorCode returns the code of the first CodedError in the chain of err, or "" if there is none.
+func ErrorCode(err error) string {
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return coded.Code()
+	}
+
+	return ""
+}
+
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func (e *codedError) Code() string {
+	return e.code
+}
+
+// withCode attaches code to err, keeping its message. Errors that already carry a code keep theirs, so the
+// most specific code set closest to the failure wins.
+func withCode(code string, err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+
+	return &codedError{code: code, err: err}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNotFound(t *testing.T) {
+	t.Run("mem", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("store")
+		require.NoError(t, err)
+
+		_, err = store.Get("missing")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("driver sentinels", func(t *testing.T) {
+		for _, err := range []error{
+			storage.ErrDataNotFound,
+			fmt.Errorf("failed to get row: %w", storage.ErrDataNotFound),
+			fmt.Errorf("query: %w", sql.ErrNoRows),
+			&httpStatusError{status: http.StatusNotFound},
+			fmt.Errorf("get document: %w", &httpStatusError{status: http.StatusNotFound}),
+		} {
+			require.True(t, IsNotFound(err), err.Error())
+		}
+	})
+
+	t.Run("unrelated errors", func(t *testing.T) {
+		for _, err := range []error{
+			nil,
+			errors.New("data not found"),
+			&httpStatusError{status: http.StatusInternalServerError},
+		} {
+			require.False(t, IsNotFound(err))
+		}
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	dbParamsErr := func(t *testing.T, env map[string]string) error {
+		t.Helper()
+
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "prefix", Timeout: 30})
+		defer unsetEnv(t)
+
+		for key, value := range env {
+			require.NoError(t, os.Setenv(key, value))
+		}
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		_, err := DBParams(cmd)
+		require.Error(t, err)
+
+		return err
+	}
+
+	t.Run("DBParams", func(t *testing.T) {
+		for env, code := range map[string]string{
+			DatabaseURLEnvKey:          ErrCodeMissingURL,
+			DatabasePrefixEnvKey:       ErrCodeMissingPrefix,
+			DatabaseTimeoutEnvKey:      ErrCodeInvalidTimeout,
+			DatabaseTotalTimeoutEnvKey: ErrCodeInvalidTimeout,
+			DatabaseMaxValueSizeEnvKey: ErrCodeInvalidConfig,
+		} {
+			value := ""
+			if env != DatabaseURLEnvKey && env != DatabasePrefixEnvKey {
+				value = "invalid"
+			}
+
+			err := dbParamsErr(t, map[string]string{env: value})
+			require.Equal(t, code, ErrorCode(err), env)
+		}
+
+		err := dbParamsErr(t, map[string]string{DatabaseURLEnvKey: "mem://${UNSET_SANDBOX_HOST}"})
+		require.Equal(t, ErrCodeInvalidURL, ErrorCode(err))
+	})
+
+	t.Run("InitEdgeStore", func(t *testing.T) {
+		for url, code := range map[string]string{
+			"invalid":                  ErrCodeInvalidURL,
+			"redis://localhost":        ErrCodeUnsupportedDriver,
+			"couchdb+ftp://localhost":  ErrCodeUnsupportedDriver,
+			"mem://test?timeout=never": ErrCodeInvalidTimeout,
+		} {
+			_, err := InitEdgeStore(&DBParameters{URL: url, Timeout: 1}, logger)
+			require.Error(t, err)
+			require.Equal(t, code, ErrorCode(err), url)
+		}
+
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, errors.New("not ready")
+		})
+
+		_, err := InitEdgeStore(&DBParameters{URL: "fake://localhost", Timeout: 1}, logger)
+		require.Error(t, err)
+		require.Equal(t, ErrCodeConnectFailed, ErrorCode(err))
+	})
+
+	t.Run("keeps the message and the chain", func(t *testing.T) {
+		err := withCode(ErrCodeInvalidURL, fmt.Errorf("wrapped: %w", storage.ErrDataNotFound))
+		require.EqualError(t, err, "wrapped: data not found")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		var coded CodedError
+		require.True(t, errors.As(fmt.Errorf("outer: %w", err), &coded))
+		require.Equal(t, ErrCodeInvalidURL, coded.Code())
+
+		require.Equal(t, ErrCodeInvalidURL, ErrorCode(withCode(ErrCodeConnectFailed, err)))
+		require.Empty(t, ErrorCode(errors.New("plain")))
+		require.NoError(t, withCode(ErrCodeInvalidURL, nil))
+	})
+}
+
+// httpStatusError mimics the errors of the CouchDB client.
+type httpStatusError struct {
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return http.StatusText(e.status)
+}
+
+func (e *httpStatusError) StatusCode() int {
+	return e.status
+}
+
+func TestRetryExhaustedError(t *testing.T) {
+	t.Run("all attempts fail", func(t *testing.T) {
+		calls := 0
+
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			calls++
+
+			return nil, errors.New("connection refused")
+		})
+
+		_, err := BuildProvider(&DBParameters{URL: "fake://localhost", Timeout: 3}, logger,
+			WithClock(newFakeClock()))
+		require.EqualError(t, err,
+			"failed to connect to storage at localhost : storage connection timed out, giving up after 4 attempts: "+
+				"connection refused")
+
+		var exhausted *RetryExhaustedError
+		require.True(t, errors.As(err, &exhausted))
+		require.Equal(t, 4, exhausted.Attempts)
+		require.Equal(t, calls, exhausted.Attempts)
+		require.EqualError(t, exhausted.Err, "connection refused")
+		require.Equal(t, ErrCodeConnectFailed, ErrorCode(err))
+		require.True(t, errors.Is(err, ErrConnectTimeout))
+		require.Contains(t, err.Error(), ErrConnectTimeout.Error())
+	})
+
+	t.Run("errors that stop the retries", func(t *testing.T) {
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			panic("malformed url")
+		})
+
+		_, err := InitEdgeStore(&DBParameters{URL: "fake://localhost", Timeout: 3}, logger)
+		require.Error(t, err)
+
+		var exhausted *RetryExhaustedError
+		require.False(t, errors.As(err, &exhausted))
+		require.False(t, errors.Is(err, ErrConnectTimeout))
+	})
+}
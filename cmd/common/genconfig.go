@@ -0,0 +1,108 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// genConfigOutputFlagName is the flag of the genconfig command giving the file to write.
+const genConfigOutputFlagName = "output"
+
+// envKeyDefaults are the values DBParams uses for the environment variables that have a default.
+func envKeyDefaults() map[string]string {
+	return map[string]string{
+		DatabaseTimeoutEnvKey:      strconv.Itoa(DatabaseTimeoutDefault),
+		DatabaseTimeoutUnitEnvKey:  "s",
+		DatabaseTotalTimeoutEnvKey: "0",
+		DatabaseStoreNameEnvKey:    DatabaseStoreNameDefault,
+		DatabaseHealthStoreEnvKey:  DatabaseHealthStoreDefault,
+		DatabasePingQueryEnvKey:    DatabasePingQueryDefault,
+		DatabaseMaxValueSizeEnvKey: "0",
+		DatabaseMaxStoresEnvKey:    "0",
+		DatabaseAllowClearEnvKey:   "false",
+		DatabaseRetryJitterEnvKey:  "false",
+	}
+}
+
+// BuildGenConfigCommand builds a command that writes a sample env file, loadable with LoadDotEnv, listing every
+// environment variable of DescribeEnvKeys with its description and default. It writes to stdout unless a path
+// is given with --output.
+func BuildGenConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "genconfig",
+		Short: "Generate a sample database configuration",
+		Long:  "Generate a commented sample env file with the environment variables of the database configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sample bytes.Buffer
+
+			writeSampleEnv(&sample)
+
+			path, err := cmd.Flags().GetString(genConfigOutputFlagName)
+			if err != nil {
+				return err
+			}
+
+			if path == "" {
+				_, err = cmd.OutOrStdout().Write(sample.Bytes())
+
+				return err
+			}
+
+			if err = ioutil.WriteFile(path, sample.Bytes(), 0o600); err != nil {
+				return fmt.Errorf("write sample configuration: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP(genConfigOutputFlagName, "o", "", "File to write the sample configuration to. "+
+		"Default: stdout")
+
+	return cmd
+}
+
+// writeSampleEnv writes the environment variables sorted by name, each preceded by its description. Variables
+// without a default are left empty.
+func writeSampleEnv(out io.Writer) {
+	keys := DescribeEnvKeys()
+	defaults := envKeyDefaults()
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+
+		fmt.Fprintf(out, "# %s\n%s=%s\n", describeEnvKey(keys[name]), name, defaults[name])
+	}
+}
+
+// describeEnvKey drops the sentence of a flag usage pointing at its environment variable, which the sample
+// already names.
+func describeEnvKey(usage string) string {
+	if i := strings.Index(usage, "Alternatively, this can be set"); i >= 0 {
+		usage = usage[:i]
+	}
+
+	return strings.TrimSpace(usage)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildGenConfigCommand(t *testing.T) {
+	t.Run("stdout", func(t *testing.T) {
+		var out bytes.Buffer
+
+		cmd := BuildGenConfigCommand()
+		cmd.SetOut(&out)
+		cmd.SetArgs(nil)
+		require.NoError(t, cmd.Execute())
+
+		sample := out.String()
+		require.Contains(t, sample, "# Database URL with credentials if required.")
+		require.Contains(t, sample, "\nDATABASE_URL=\n")
+		require.Contains(t, sample, "\nDATABASE_PREFIX=\n")
+		require.Contains(t, sample, "\nDATABASE_TIMEOUT=30\n")
+		require.NotContains(t, sample, "Alternatively")
+	})
+
+	t.Run("loadable from a path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db.env")
+
+		cmd := BuildGenConfigCommand()
+		cmd.SetArgs([]string{"--" + genConfigOutputFlagName, path})
+		require.NoError(t, cmd.Execute())
+
+		sample, err := ioutil.ReadFile(path) // nolint:gosec
+		require.NoError(t, err)
+		require.Contains(t, string(sample), "\nDATABASE_STORE_NAME="+DatabaseStoreNameDefault+"\n")
+
+		defer unsetEnv(t)
+
+		require.NoError(t, LoadDotEnv(path))
+		require.Equal(t, "30", os.Getenv(DatabaseTimeoutEnvKey))
+
+		require.NoError(t, os.Setenv(DatabaseURLEnvKey, "mem://test"))
+		require.NoError(t, os.Setenv(DatabasePrefixEnvKey, "app"))
+
+		cmd = &cobra.Command{}
+		Flags(cmd)
+		_, err = DBParams(cmd)
+		require.NoError(t, err)
+	})
+}
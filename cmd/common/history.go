@@ -0,0 +1,93 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// OpRecord describes a store operation recorded by WithOperationHistory.
+type OpRecord struct {
+	// Op is the store method name, such as Put.
+	Op string
+	// Store is the name the store was opened with.
+	Store string
+	// Key is empty for operations that are not tied to a single key.
+	Key      string
+	Duration time.Duration
+	Err      error
+}
+
+// HistoryReporter is implemented by the providers built WithOperationHistory.
+type HistoryReporter interface {
+	// History returns the recorded operations, oldest first.
+	History() []OpRecord
+}
+
+// WithOperationHistory keeps the last size store operations made through the provider, timed on the clock given
+// with WithClock, so that they can be inspected without verbose logging. The provider returned by
+// BuildProvider then implements HistoryReporter. A size of zero or less disables the history.
+func WithOperationHistory(size int) BuildOption {
+	return func(opts *buildOptions) {
+		if size <= 0 {
+			return
+		}
+
+		history := &operationHistory{records: make([]OpRecord, 0, size), size: size}
+		opts.history = history
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return interceptStores(p, func(op, storeName, key string, call func() error) error {
+				start := opts.clock.Now()
+				err := call()
+
+				history.add(OpRecord{
+					Op: op, Store: storeName, Key: key, Duration: opts.clock.Now().Sub(start), Err: err,
+				})
+
+				return err
+			})
+		})
+	}
+}
+
+// operationHistory is a ring buffer of the last size records.
+type operationHistory struct {
+	mutex   sync.Mutex
+	records []OpRecord
+	size    int
+	next    int
+}
+
+func (h *operationHistory) add(record OpRecord) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.records) < h.size {
+		h.records = append(h.records, record)
+
+		return
+	}
+
+	h.records[h.next] = record
+	h.next = (h.next + 1) % h.size
+}
+
+func (h *operationHistory) History() []OpRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append(append([]OpRecord{}, h.records[h.next:]...), h.records[:h.next]...)
+}
+
+type historyProvider struct {
+	*builtProvider
+	*operationHistory
+}
@@ -0,0 +1,77 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithOperationHistory(t *testing.T) {
+	p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithOperationHistory(3))
+	require.NoError(t, err)
+
+	reporter, ok := p.(HistoryReporter)
+	require.True(t, ok)
+
+	s, err := p.OpenStore("jobs")
+	require.NoError(t, err)
+
+	t.Run("keeps the most recent records", func(t *testing.T) {
+		require.Empty(t, reporter.History())
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, s.Put(strconv.Itoa(i), []byte("job")))
+		}
+
+		_, err = s.Get("missing")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+		history := reporter.History()
+		require.Len(t, history, 3)
+		require.Equal(t, OpRecord{Op: "Put", Store: "jobs", Key: "3"}, withoutDuration(history[0]))
+		require.Equal(t, OpRecord{Op: "Put", Store: "jobs", Key: "4"}, withoutDuration(history[1]))
+		require.Equal(t, "Get", history[2].Op)
+		require.ErrorIs(t, history[2].Err, storage.ErrDataNotFound)
+	})
+
+	t.Run("concurrent operations", func(t *testing.T) {
+		var wg sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				require.NoError(t, s.Put(strconv.Itoa(i), []byte("job")))
+				require.LessOrEqual(t, len(reporter.History()), 3)
+			}(i)
+		}
+
+		wg.Wait()
+		require.Len(t, reporter.History(), 3)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithOperationHistory(0))
+		require.NoError(t, err)
+
+		_, ok := p.(HistoryReporter)
+		require.False(t, ok)
+	})
+}
+
+func withoutDuration(record OpRecord) OpRecord {
+	record.Duration = 0
+
+	return record
+}
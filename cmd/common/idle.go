@@ -0,0 +1,482 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// WithIdleClose closes the connection of the provider once no operation was made on it for after, and
+// reconnects on the next call, reopening the stores that were open. This frees the server slot held by rarely
+// used commands. The idle time is measured with the clock set by WithClock.
+func WithIdleClose(after time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		opts.idleClose = after
+	}
+}
+
+// WithLazyConnect defers connecting to the storage until the first operation on a store opened through the
+// provider, so that commands which may never use it don't pay for the connection at startup. BuildProvider then
+// doesn't connect, and the connection errors, WithWaitForHealthy included, are returned by that first operation.
+// Opening a store doesn't connect either. A failed connection is attempted again by the next operation.
+func WithLazyConnect() BuildOption {
+	return func(opts *buildOptions) {
+		opts.lazyConnect = true
+	}
+}
+
+// idleProvider connects with connect on demand: when it was created without connection and, if after is set, when
+// the connection was closed after being idle for that long. It then reopens the stores that were open when
+// operations are made on them. Unless lazy is set, OpenStore connects.
+type idleProvider struct {
+	connect func() (storage.Provider, error)
+	after   time.Duration
+	clock   Clock
+	lazy    bool
+	// onDisconnect, if set, is called after the connection is closed for idleness
+	onDisconnect func()
+
+	mutex      sync.Mutex
+	current    storage.Provider
+	connecting *idleConnection
+	generation int
+	stores     map[string]storage.Store
+	handles    map[string]*idleStore
+	inFlight   int
+	lastUse    time.Time
+	closed     bool
+}
+
+func newIdleProvider(p storage.Provider, after time.Duration, clock Clock,
+	connect func() (storage.Provider, error)) *idleProvider {
+	idle := &idleProvider{
+		connect: connect,
+		after:   after,
+		clock:   clock,
+		handles: map[string]*idleStore{},
+	}
+
+	if p != nil {
+		idle.setCurrent(p)
+	}
+
+	return idle
+}
+
+// newLazyProvider returns an idleProvider that makes its first connection, as BuildProvider would, on the first
+// store operation. Reconnections after idleness only connect, like those of WithIdleClose.
+func newLazyProvider(params *DBParameters, logger log.Logger, options *buildOptions) *idleProvider {
+	prepared := false
+
+	idle := newIdleProvider(nil, options.idleClose, options.clock, func() (storage.Provider, error) {
+		if prepared {
+			return connectPrimaryAndReplica(params, logger, options)
+		}
+
+		// calls of connect don't overlap, see acquire, so prepared needs no lock
+		provider, err := connectAndPrepare(params, logger, options)
+		if err != nil {
+			return nil, err
+		}
+
+		prepared = true
+
+		return provider, nil
+	})
+	idle.lazy = true
+
+	return idle
+}
+
+// setCurrent makes p the connection of the provider and, if after is set, starts watching it for idleness. It
+// must be called with the mutex held, or before the provider is shared.
+func (p *idleProvider) setCurrent(conn storage.Provider) {
+	p.current = conn
+	p.generation++
+	p.stores = map[string]storage.Store{}
+	p.lastUse = p.clock.Now()
+
+	if p.after > 0 {
+		go p.watch(p.generation)
+	}
+}
+
+func (p *idleProvider) watch(generation int) {
+	wait := p.after
+
+	for {
+		<-p.clock.After(wait)
+
+		p.mutex.Lock()
+
+		if p.closed || p.generation != generation {
+			p.mutex.Unlock()
+
+			return
+		}
+
+		idle := p.clock.Now().Sub(p.lastUse)
+
+		if p.inFlight == 0 && idle >= p.after {
+			conn := p.current
+			p.current, p.stores = nil, nil
+			p.mutex.Unlock()
+
+			// the connection is reopened on the next call, which reports the errors of the backend
+			_ = conn.Close() // nolint:errcheck
+
+			if p.onDisconnect != nil {
+				p.onDisconnect()
+			}
+
+			return
+		}
+
+		wait = p.after - idle
+		if p.inFlight > 0 || wait <= 0 {
+			wait = p.after
+		}
+
+		p.mutex.Unlock()
+	}
+}
+
+// idleConnection is a call of connect in progress on an idleProvider, whose err is set once done is closed.
+type idleConnection struct {
+	done chan struct{}
+	err  error
+}
+
+// acquire returns the connection, reconnecting if it was closed for idleness, and counts an operation in
+// flight until release is called. The connection is made without the mutex held, so that operations on a
+// closed provider don't wait for it, and only once for the callers that need it at the same time.
+func (p *idleProvider) acquire() (storage.Provider, error) {
+	p.mutex.Lock()
+
+	for p.current == nil && !p.closed {
+		connection := p.connecting
+		if connection == nil {
+			connection = &idleConnection{done: make(chan struct{})}
+			p.connecting = connection
+			p.mutex.Unlock()
+
+			p.reconnect(connection)
+		} else {
+			p.mutex.Unlock()
+		}
+
+		<-connection.done
+
+		if connection.err != nil {
+			return nil, connection.err
+		}
+
+		p.mutex.Lock()
+	}
+
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, ErrProviderClosed
+	}
+
+	p.inFlight++
+	p.lastUse = p.clock.Now()
+
+	return p.current, nil
+}
+
+// reconnect calls connect for connection, making its result the current connection unless the provider was
+// closed in the meantime. The waiters are released even if connect panics.
+func (p *idleProvider) reconnect(connection *idleConnection) {
+	connection.err = errors.New("connect to storage: panicked")
+
+	defer func() {
+		p.mutex.Lock()
+		p.connecting = nil
+		p.mutex.Unlock()
+
+		close(connection.done)
+	}()
+
+	conn, err := p.connect()
+	if err != nil {
+		connection.err = err
+
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		// the connection is not used, its errors don't matter to the caller
+		_ = conn.Close() // nolint:errcheck
+		connection.err = ErrProviderClosed
+
+		return
+	}
+
+	connection.err = nil
+	p.setCurrent(conn)
+}
+
+// hold counts an operation in flight until release is called, as acquire does, for a connection already held.
+func (p *idleProvider) hold() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.inFlight++
+}
+
+func (p *idleProvider) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.inFlight--
+	p.lastUse = p.clock.Now()
+}
+
+// do runs fn on the store name of the current connection, opening it on the connection if needed.
+func (p *idleProvider) do(name string, fn func(s storage.Store) error) error {
+	conn, err := p.acquire()
+	if err != nil {
+		return err
+	}
+
+	defer p.release()
+
+	p.mutex.Lock()
+	store, ok := p.stores[name]
+	p.mutex.Unlock()
+
+	if !ok {
+		store, err = conn.OpenStore(name)
+		if err != nil {
+			return err
+		}
+
+		p.mutex.Lock()
+		if p.stores != nil {
+			p.stores[name] = store
+		}
+		p.mutex.Unlock()
+	}
+
+	return fn(store)
+}
+
+func (p *idleProvider) OpenStore(name string) (storage.Store, error) {
+	if !p.lazy {
+		if err := p.do(name, func(storage.Store) error { return nil }); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, ErrProviderClosed
+	}
+
+	handle, ok := p.handles[name]
+	if !ok {
+		handle = &idleStore{provider: p, name: name}
+		p.handles[name] = handle
+	}
+
+	return handle, nil
+}
+
+func (p *idleProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	conn, err := p.acquire()
+	if err != nil {
+		return err
+	}
+
+	defer p.release()
+
+	return conn.SetStoreConfig(name, config)
+}
+
+func (p *idleProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	conn, err := p.acquire()
+	if err != nil {
+		return storage.StoreConfiguration{}, err
+	}
+
+	defer p.release()
+
+	return conn.GetStoreConfig(name)
+}
+
+func (p *idleProvider) GetOpenStores() []storage.Store {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.handles))
+	for name := range p.handles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	stores := make([]storage.Store, len(names))
+	for i, name := range names {
+		stores[i] = p.handles[name]
+	}
+
+	return stores
+}
+
+func (p *idleProvider) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+
+	if p.current == nil {
+		return nil
+	}
+
+	conn := p.current
+	p.current, p.stores = nil, nil
+
+	return conn.Close()
+}
+
+// closeStore closes the store name on the current connection, if it is connected, and forgets it.
+func (p *idleProvider) closeStore(name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.handles, name)
+
+	store, ok := p.stores[name]
+	if !ok {
+		return nil
+	}
+
+	delete(p.stores, name)
+
+	return store.Close()
+}
+
+// idleStore is a store of an idleProvider, which runs each operation on the store of the current connection.
+type idleStore struct {
+	provider *idleProvider
+	name     string
+}
+
+func (s *idleStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.provider.do(s.name, func(store storage.Store) error {
+		return store.Put(key, value, tags...)
+	})
+}
+
+func (s *idleStore) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := s.provider.do(s.name, func(store storage.Store) error {
+		var err error
+		value, err = store.Get(key)
+
+		return err
+	})
+
+	return value, err
+}
+
+func (s *idleStore) GetTags(key string) ([]storage.Tag, error) {
+	var tags []storage.Tag
+
+	err := s.provider.do(s.name, func(store storage.Store) error {
+		var err error
+		tags, err = store.GetTags(key)
+
+		return err
+	})
+
+	return tags, err
+}
+
+func (s *idleStore) GetBulk(keys ...string) ([][]byte, error) {
+	var values [][]byte
+
+	err := s.provider.do(s.name, func(store storage.Store) error {
+		var err error
+		values, err = store.GetBulk(keys...)
+
+		return err
+	})
+
+	return values, err
+}
+
+// Query keeps the connection in use until the iterator is closed, so that it is not closed for idleness while
+// the results are read.
+func (s *idleStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	var iterator storage.Iterator
+
+	err := s.provider.do(s.name, func(store storage.Store) error {
+		var err error
+
+		iterator, err = store.Query(expression, options...)
+		if err == nil {
+			s.provider.hold()
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &idleIterator{Iterator: iterator, provider: s.provider}, nil
+}
+
+func (s *idleStore) Delete(key string) error {
+	return s.provider.do(s.name, func(store storage.Store) error {
+		return store.Delete(key)
+	})
+}
+
+func (s *idleStore) Batch(operations []storage.Operation) error {
+	return s.provider.do(s.name, func(store storage.Store) error {
+		return store.Batch(operations)
+	})
+}
+
+func (s *idleStore) Flush() error {
+	return s.provider.do(s.name, func(store storage.Store) error {
+		return store.Flush()
+	})
+}
+
+func (s *idleStore) Close() error {
+	return s.provider.closeStore(s.name)
+}
+
+// idleIterator is an iterator of an idleStore, counted as an operation in flight on its provider until closed.
+type idleIterator struct {
+	storage.Iterator
+	provider *idleProvider
+	once     sync.Once
+}
+
+func (i *idleIterator) Close() error {
+	i.once.Do(i.provider.release)
+
+	return i.Iterator.Close()
+}
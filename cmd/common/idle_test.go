@@ -0,0 +1,350 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdleClose(t *testing.T) {
+	setup := func(t *testing.T) (storage.Provider, *connectionCounter, *manualClock) {
+		t.Helper()
+
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		registerTestFactory(t, "idle", counter.connect)
+
+		clock := &manualClock{ticks: make(chan time.Time)}
+
+		p, err := BuildProvider(&DBParameters{URL: "idle://test", Timeout: 1}, logger,
+			WithClock(clock), WithIdleClose(time.Minute))
+		require.NoError(t, err)
+
+		return p, counter, clock
+	}
+
+	t.Run("closes after idle and reconnects on use", func(t *testing.T) {
+		p, counter, clock := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		clock.advance(time.Minute)
+		clock.ticks <- clock.Now()
+
+		require.Eventually(t, func() bool {
+			return counter.counts() == [2]int{1, 1}
+		}, time.Second, time.Millisecond)
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+		require.Equal(t, [2]int{2, 1}, counter.counts())
+
+		clock.advance(time.Minute)
+		clock.ticks <- clock.Now()
+
+		require.Eventually(t, func() bool {
+			return counter.counts() == [2]int{2, 2}
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("operations postpone the close", func(t *testing.T) {
+		p, counter, clock := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		clock.advance(30 * time.Second)
+		require.NoError(t, s.Put("key", []byte("value")))
+		clock.advance(30 * time.Second)
+
+		// the second tick is only received once the first one was handled, and it doesn't close either
+		clock.ticks <- clock.Now()
+		clock.ticks <- clock.Now()
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+
+		clock.advance(30 * time.Second)
+
+		require.Eventually(t, func() bool {
+			// the watcher may still be handling the previous tick, sending the next one must not block
+			select {
+			case clock.ticks <- clock.Now():
+			default:
+			}
+
+			return counter.counts() == [2]int{1, 1}
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("reconnect error", func(t *testing.T) {
+		p, counter, clock := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		clock.advance(time.Minute)
+		clock.ticks <- clock.Now()
+
+		require.Eventually(t, func() bool {
+			return counter.counts() == [2]int{1, 1}
+		}, time.Second, time.Millisecond)
+
+		registerTestFactory(t, "idle", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, errors.New("server full")
+		})
+
+		done := make(chan struct{})
+		defer close(done)
+
+		// drives the retry timers of the reconnection until it gives up
+		go func() {
+			for {
+				clock.advance(time.Second)
+
+				select {
+				case clock.ticks <- clock.Now():
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		_, err = s.Get("key")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "server full")
+	})
+
+	t.Run("open iterators keep the connection in use", func(t *testing.T) {
+		p, counter, clock := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value"), EntryTag))
+
+		iterator, err := s.Query(EntryTagName)
+		require.NoError(t, err)
+
+		clock.advance(time.Minute)
+
+		// the second tick is only received once the first one was handled, and it doesn't close either
+		clock.ticks <- clock.Now()
+		clock.ticks <- clock.Now()
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+
+		require.NoError(t, iterator.Close())
+		require.NoError(t, iterator.Close())
+		clock.advance(time.Minute)
+
+		require.Eventually(t, func() bool {
+			select {
+			case clock.ticks <- clock.Now():
+			default:
+			}
+
+			return counter.counts() == [2]int{1, 1}
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("closed by the caller", func(t *testing.T) {
+		p, counter, _ := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.Len(t, p.GetOpenStores(), 1)
+
+		require.NoError(t, p.Close())
+		require.Equal(t, [2]int{1, 1}, counter.counts())
+
+		require.ErrorIs(t, s.Put("key", []byte("value")), ErrProviderClosed)
+	})
+}
+
+func TestWithLazyConnect(t *testing.T) {
+	t.Run("connects on the first operation", func(t *testing.T) {
+		calls := recordingFactory(t, "lazy")
+
+		p, err := BuildProvider(&DBParameters{URL: "lazy://test"}, logger, WithLazyConnect())
+		require.NoError(t, err)
+		require.Empty(t, *calls)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.Empty(t, *calls)
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.Len(t, *calls, 1)
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+		require.Len(t, *calls, 1)
+
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("returns connection errors from the first operation", func(t *testing.T) {
+		attempts := 0
+
+		registerTestFactory(t, "lazy", func(string, *DBParameters) (storage.Provider, error) {
+			attempts++
+
+			return nil, backoff.Permanent(errors.New("unreachable"))
+		})
+
+		p, err := BuildProvider(&DBParameters{URL: "lazy://test"}, logger, WithLazyConnect())
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.Zero(t, attempts)
+
+		_, err = s.Get("key")
+		require.EqualError(t, err, "failed to connect to storage at test : unreachable")
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("runs connection hooks once", func(t *testing.T) {
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		registerTestFactory(t, "lazy", counter.connect)
+
+		p, err := BuildProvider(&DBParameters{URL: "lazy://test"}, logger, WithLazyConnect(),
+			WithIndexes(map[string][]string{"indexed": {"tag"}}))
+		require.NoError(t, err)
+		require.Equal(t, [2]int{0, 0}, counter.counts())
+
+		config, err := p.GetStoreConfig("indexed")
+		require.NoError(t, err)
+		require.Equal(t, []string{"tag"}, config.TagNames)
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+	})
+}
+
+func TestIdleProviderConnect(t *testing.T) {
+	// the connections wait for release, connecting reports once one is waiting
+	setup := func(t *testing.T) (storage.Provider, *connectionCounter, chan struct{}, func() bool) {
+		t.Helper()
+
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		release := make(chan struct{})
+
+		var waiting int32
+
+		registerTestFactory(t, "lazy", func(dsn string, params *DBParameters) (storage.Provider, error) {
+			atomic.AddInt32(&waiting, 1)
+			<-release
+
+			return counter.connect(dsn, params)
+		})
+
+		p, err := BuildProvider(&DBParameters{URL: "lazy://test"}, logger, WithLazyConnect())
+		require.NoError(t, err)
+
+		return p, counter, release, func() bool {
+			return atomic.LoadInt32(&waiting) == 1
+		}
+	}
+
+	t.Run("connects once without holding the provider", func(t *testing.T) {
+		p, counter, release, connecting := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		errs := make(chan error)
+
+		for i := 0; i < 2; i++ {
+			go func() {
+				errs <- s.Put("key", []byte("value"))
+			}()
+		}
+
+		require.Eventually(t, connecting, time.Second, time.Millisecond)
+		require.Len(t, p.GetOpenStores(), 1)
+
+		close(release)
+		require.NoError(t, <-errs)
+		require.NoError(t, <-errs)
+		require.Equal(t, [2]int{1, 0}, counter.counts())
+
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("closed while connecting", func(t *testing.T) {
+		p, counter, release, connecting := setup(t)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		errs := make(chan error)
+
+		go func() {
+			errs <- s.Put("key", []byte("value"))
+		}()
+
+		require.Eventually(t, connecting, time.Second, time.Millisecond)
+		require.NoError(t, p.Close())
+
+		close(release)
+		require.ErrorIs(t, <-errs, ErrProviderClosed)
+		require.Equal(t, [2]int{1, 1}, counter.counts())
+	})
+}
+
+// connectionCounter is a storage factory whose connections share backend, counting how many are opened and
+// closed.
+type connectionCounter struct {
+	backend storage.Provider
+	mutex   sync.Mutex
+	opened  int
+	closed  int
+}
+
+func (c *connectionCounter) connect(string, *DBParameters) (storage.Provider, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.opened++
+
+	return &countedConnection{Provider: c.backend, counter: c}, nil
+}
+
+func (c *connectionCounter) counts() [2]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return [2]int{c.opened, c.closed}
+}
+
+type countedConnection struct {
+	storage.Provider
+	counter *connectionCounter
+}
+
+func (c *countedConnection) Close() error {
+	c.counter.mutex.Lock()
+	defer c.counter.mutex.Unlock()
+
+	c.counter.closed++
+
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// IndexInspector is implemented by the providers of drivers that can list the indexes that exist in the backend
+// for a store, as tag names. The drivers in use don't implement it yet.
+type IndexInspector interface {
+	StoreIndexes(name string) ([]string, error)
+}
+
+// IndexDrift compares the indexes desired for each store, as given to WithIndexes, with those that exist in the
+// backend of p, or of the connection of a provider returned by BuildProvider. It returns, by store, the sorted
+// desired indexes that are missing and the existing ones that are not desired; stores without difference are
+// left out. Only the stores of desired are inspected, for at most the time left on ctx. ErrUnsupportedOperation
+// is returned if the driver doesn't implement IndexInspector.
+func IndexDrift(ctx context.Context, p storage.Provider,
+	desired map[string][]string) (missing, extra map[string][]string, err error) {
+	inspector, ok := driverProvider(p).(IndexInspector)
+	if !ok {
+		return nil, nil, fmt.Errorf("index drift: %w", ErrUnsupportedOperation)
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	missing, extra = map[string][]string{}, map[string][]string{}
+
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return nil, nil, fmt.Errorf("index drift: %w", err)
+		}
+
+		existing, listErr := inspector.StoreIndexes(name)
+		if listErr != nil {
+			return nil, nil, fmt.Errorf("index drift: list indexes of %s: %w", name, listErr)
+		}
+
+		if diff := setDifference(desired[name], existing); len(diff) > 0 {
+			missing[name] = diff
+		}
+
+		if diff := setDifference(existing, desired[name]); len(diff) > 0 {
+			extra[name] = diff
+		}
+	}
+
+	return missing, extra, nil
+}
+
+// setDifference returns the sorted values of a that are not in b.
+func setDifference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, value := range b {
+		in[value] = true
+	}
+
+	var diff []string
+
+	for _, value := range a {
+		if !in[value] {
+			diff = append(diff, value)
+			in[value] = true
+		}
+	}
+
+	sort.Strings(diff)
+
+	return diff
+}
@@ -0,0 +1,74 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// indexedProvider reports indexes as the existing indexes of its stores.
+type indexedProvider struct {
+	storage.Provider
+	indexes map[string][]string
+	err     error
+}
+
+func (p *indexedProvider) StoreIndexes(name string) ([]string, error) {
+	return p.indexes[name], p.err
+}
+
+func TestIndexDrift(t *testing.T) {
+	desired := map[string][]string{
+		"credentials": {"issuer", "subject", "type"},
+		"profiles":    {"name"},
+		"tokens":      {"expiry"},
+	}
+
+	t.Run("missing and extra indexes", func(t *testing.T) {
+		registerTestDriver(t, "indexed", &indexedProvider{Provider: mem.NewProvider(), indexes: map[string][]string{
+			"credentials": {"type", "issuer", "legacy"},
+			"profiles":    {"name"},
+			"ignored":     {"anything"},
+		}})
+
+		p, err := BuildProvider(&DBParameters{URL: "indexed://test"}, logger)
+		require.NoError(t, err)
+
+		missing, extra, err := IndexDrift(context.Background(), p, desired)
+		require.NoError(t, err)
+		require.Equal(t, map[string][]string{"credentials": {"subject"}, "tokens": {"expiry"}}, missing)
+		require.Equal(t, map[string][]string{"credentials": {"legacy"}}, extra)
+	})
+
+	t.Run("no drift", func(t *testing.T) {
+		missing, extra, err := IndexDrift(context.Background(),
+			&indexedProvider{Provider: mem.NewProvider(), indexes: desired}, desired)
+		require.NoError(t, err)
+		require.Empty(t, missing)
+		require.Empty(t, extra)
+	})
+
+	t.Run("inspection error", func(t *testing.T) {
+		_, _, err := IndexDrift(context.Background(),
+			&indexedProvider{Provider: mem.NewProvider(), err: errors.New("unauthorized")}, desired)
+		require.EqualError(t, err, "index drift: list indexes of credentials: unauthorized")
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+
+		_, _, err = IndexDrift(context.Background(), p, desired)
+		require.True(t, errors.Is(err, ErrUnsupportedOperation))
+	})
+}
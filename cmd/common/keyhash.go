@@ -0,0 +1,148 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// OriginalKeyTagName is the tag holding the key given by the caller on the entries written by providers built
+// WithKeyHashing, so that the query iterators can return it.
+const OriginalKeyTagName = "original_key"
+
+// SHA256Key returns the hex SHA-256 hash of key, the default hash of WithKeyHashing.
+func SHA256Key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// WithKeyHashing stores the entries under hash(key), SHA256Key if hash is nil, for backends whose key length or
+// charset limits the keys of the callers violate. All the store operations take and return the original keys:
+// the iterators of Query read them from the OriginalKeyTagName tag, which GetTags and Tags leave out. hash must be
+// deterministic and, for distinct keys not to overwrite each other, should be collision-free.
+func WithKeyHashing(hash func(key string) string) BuildOption {
+	if hash == nil {
+		hash = SHA256Key
+	}
+
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &hashedKeyStore{Store: s, hash: hash}
+			})
+		})
+	}
+}
+
+type hashedKeyStore struct {
+	storage.Store
+	hash func(key string) string
+}
+
+func (s *hashedKeyStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.Store.Put(s.hash(key), value, withOriginalKey(key, tags)...)
+}
+
+func (s *hashedKeyStore) Get(key string) ([]byte, error) {
+	return s.Store.Get(s.hash(key))
+}
+
+func (s *hashedKeyStore) GetTags(key string) ([]storage.Tag, error) {
+	tags, err := s.Store.GetTags(s.hash(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutOriginalKey(tags), nil
+}
+
+func (s *hashedKeyStore) GetBulk(keys ...string) ([][]byte, error) {
+	hashed := make([]string, len(keys))
+
+	for i, key := range keys {
+		hashed[i] = s.hash(key)
+	}
+
+	return s.Store.GetBulk(hashed...)
+}
+
+func (s *hashedKeyStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hashedKeyIterator{Iterator: iterator}, nil
+}
+
+func (s *hashedKeyStore) Delete(key string) error {
+	return s.Store.Delete(s.hash(key))
+}
+
+func (s *hashedKeyStore) Batch(operations []storage.Operation) error {
+	hashed := make([]storage.Operation, len(operations))
+
+	for i, op := range operations {
+		hashed[i] = storage.Operation{Key: s.hash(op.Key), Value: op.Value, Tags: op.Tags}
+
+		if op.Value != nil {
+			hashed[i].Tags = withOriginalKey(op.Key, op.Tags)
+		}
+	}
+
+	return s.Store.Batch(hashed)
+}
+
+func withOriginalKey(key string, tags []storage.Tag) []storage.Tag {
+	return append(withoutOriginalKey(tags), storage.Tag{Name: OriginalKeyTagName, Value: key})
+}
+
+func withoutOriginalKey(tags []storage.Tag) []storage.Tag {
+	kept := make([]storage.Tag, 0, len(tags))
+
+	for _, tag := range tags {
+		if tag.Name != OriginalKeyTagName {
+			kept = append(kept, tag)
+		}
+	}
+
+	return kept
+}
+
+// hashedKeyIterator returns the original keys of the entries, or the stored key of those written without
+// WithKeyHashing.
+type hashedKeyIterator struct {
+	storage.Iterator
+}
+
+func (i *hashedKeyIterator) Key() (string, error) {
+	tags, err := i.Iterator.Tags()
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range tags {
+		if tag.Name == OriginalKeyTagName {
+			return tag.Value, nil
+		}
+	}
+
+	return i.Iterator.Key()
+}
+
+func (i *hashedKeyIterator) Tags() ([]storage.Tag, error) {
+	tags, err := i.Iterator.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutOriginalKey(tags), nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithKeyHashing(t *testing.T) {
+	key := strings.Repeat("did:example:123/credentials?", 20) + "\x00"
+
+	backend := mem.NewProvider()
+	registerTestDriver(t, "hashed", backend)
+
+	p, err := BuildProvider(&DBParameters{URL: "hashed://test"}, logger, WithKeyHashing(nil))
+	require.NoError(t, err)
+
+	s, err := p.OpenStore("documents")
+	require.NoError(t, err)
+
+	raw, err := backend.OpenStore("documents")
+	require.NoError(t, err)
+
+	t.Run("round trips a long key", func(t *testing.T) {
+		require.NoError(t, s.Put(key, []byte("value"), storage.Tag{Name: "kind", Value: "vc"}))
+
+		stored, err := raw.Get(SHA256Key(key))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), stored)
+
+		_, err = raw.Get(key)
+		require.True(t, IsNotFound(err))
+
+		value, err := s.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+
+		values, err := s.GetBulk(key, "missing")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("value"), nil}, values)
+
+		tags, err := s.GetTags(key)
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{{Name: "kind", Value: "vc"}}, tags)
+	})
+
+	t.Run("query returns the original keys", func(t *testing.T) {
+		iterator, err := s.Query("kind:vc")
+		require.NoError(t, err)
+
+		defer iterator.Close() // nolint:errcheck
+
+		ok, err := iterator.Next()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		queried, err := iterator.Key()
+		require.NoError(t, err)
+		require.Equal(t, key, queried)
+
+		tags, err := iterator.Tags()
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{{Name: "kind", Value: "vc"}}, tags)
+	})
+
+	t.Run("batch and delete", func(t *testing.T) {
+		require.NoError(t, s.Batch([]storage.Operation{{Key: key + "2", Value: []byte("other")}, {Key: key}}))
+
+		_, err := raw.Get(SHA256Key(key))
+		require.True(t, IsNotFound(err))
+
+		value, err := s.Get(key + "2")
+		require.NoError(t, err)
+		require.Equal(t, []byte("other"), value)
+
+		require.NoError(t, s.Delete(key+"2"))
+
+		_, err = s.Get(key + "2")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("custom hash", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithKeyHashing(strings.ToLower))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("documents")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("Key", []byte("value")))
+
+		value, err := s.Get("KEY")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+	})
+}
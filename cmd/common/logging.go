@@ -0,0 +1,297 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/trustbloc/edge-core/pkg/log"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+)
+
+// packageLogModuleName is the module of the default package logger.
+const packageLogModuleName = "common"
+
+// urlLogLevelParam is the query parameter of a database URL applied as the default log level when
+// DatabaseURLLogLevelEnvKey is set.
+const urlLogLevelParam = "loglevel"
+
+// nolint:gochecknoglobals
+var (
+	logInstanceID      string
+	logInstanceIDMutex sync.RWMutex
+
+	defaultPackageLogger log.Logger = log.New(packageLogModuleName)
+	pkgLogger                       = defaultPackageLogger
+	pkgLoggerMutex       sync.RWMutex
+
+	masking       = true
+	maskingWarned bool
+	maskingMutex  sync.RWMutex
+)
+
+// DisableMasking toggles the masking of the passwords of database URLs in logs and errors, which is on by
+// default. It is meant for local debugging only: the first time it is disabled, a warning is logged through
+// the package logger.
+func DisableMasking(disabled bool) {
+	maskingMutex.Lock()
+	defer maskingMutex.Unlock()
+
+	masking = !disabled
+
+	if disabled && !maskingWarned {
+		maskingWarned = true
+
+		packageLogger().Warnf("Database URL masking is disabled. Credentials will appear in logs and errors.")
+	}
+}
+
+func maskingDisabled() bool {
+	maskingMutex.RLock()
+	defer maskingMutex.RUnlock()
+
+	return !masking
+}
+
+// readDBURLLogLevel applies the urlLogLevelParam query parameter of the URL with SetDefaultLogLevel, and removes
+// it from the URL, if DatabaseURLLogLevelEnvKey enables it and the log level flag is not set.
+func readDBURLLogLevel(cmd *cobra.Command, params *DBParameters) error {
+	enabled, err := getOptionalBool(cmd, DatabaseURLLogLevelFlagName, DatabaseURLLogLevelEnvKey)
+	if err != nil {
+		return fmt.Errorf("failed to configure dbURLLogLevel: %w", err)
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	dbURL, level, found := takeURLParam(params.URL, urlLogLevelParam)
+	if !found {
+		return nil
+	}
+
+	if !IsValidLogLevel(level) {
+		return fmt.Errorf("failed to configure dbURLLogLevel: invalid log level %s in dbURL", level)
+	}
+
+	params.URL = dbURL
+
+	if cmd.Flags().Lookup(LogLevelFlagName) == nil ||
+		cmdutils.GetUserSetOptionalVarFromString(cmd, LogLevelFlagName, LogLevelEnvKey) == "" {
+		SetDefaultLogLevel(packageLogger(), level)
+	}
+
+	return nil
+}
+
+// SetPackageLogger routes the logging done by this package outside of InitEdgeStore, such as while reading the
+// configuration, through logger. A nil logger restores the default package logger.
+func SetPackageLogger(logger log.Logger) {
+	pkgLoggerMutex.Lock()
+	defer pkgLoggerMutex.Unlock()
+
+	if logger == nil {
+		logger = defaultPackageLogger
+	}
+
+	pkgLogger = logger
+}
+
+func packageLogger() log.Logger {
+	pkgLoggerMutex.RLock()
+	defer pkgLoggerMutex.RUnlock()
+
+	return pkgLogger
+}
+
+// SetLogInstanceID sets the identifier that loggers returned by InstrumentedLogger add to every line, so that
+// logs aggregated from several replicas can be told apart. An empty id disables the field.
+func SetLogInstanceID(id string) {
+	logInstanceIDMutex.Lock()
+	defer logInstanceIDMutex.Unlock()
+
+	logInstanceID = id
+}
+
+func instanceID() string {
+	logInstanceIDMutex.RLock()
+	defer logInstanceIDMutex.RUnlock()
+
+	return logInstanceID
+}
+
+// ValidateLogLevel parses level, case-insensitively, without changing any log level, so that user input can be
+// checked before it is applied.
+func ValidateLogLevel(level string) (log.Level, error) {
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return 0, fmt.Errorf("invalid log level %s: %w", level, err)
+	}
+
+	return logLevel, nil
+}
+
+// IsValidLogLevel reports whether level is a valid log level, as ValidateLogLevel does.
+func IsValidLogLevel(level string) bool {
+	_, err := ValidateLogLevel(level)
+
+	return err == nil
+}
+
+// LogStartup logs a summary of the database configuration in params, with the passwords of the URLs masked, at
+// params.StartupLogLevel, INFO if it is not set. The logger drops the summary if its level is higher.
+func LogStartup(logger log.Logger, params *DBParameters) {
+	logLevel := log.INFO
+
+	if params.StartupLogLevel != "" {
+		// DBParams validates the level; an invalid one set directly falls back to the default
+		if parsed, err := ValidateLogLevel(params.StartupLogLevel); err == nil {
+			logLevel = parsed
+		}
+	}
+
+	logf := logger.Infof
+
+	switch logLevel {
+	case log.CRITICAL, log.ERROR:
+		logf = logger.Errorf
+	case log.WARNING:
+		logf = logger.Warnf
+	case log.DEBUG:
+		logf = logger.Debugf
+	}
+
+	logf("database configuration: driver=%s url=%s replica=%s prefix=%s store=%s timeout=%d",
+		driverName(params), maskURL(params.URL), maskURL(params.ReplicaURL), params.Prefix, params.StoreName,
+		params.Timeout)
+}
+
+// WithTemporaryLogLevel sets the log level of module, returning a function that restores the previous level.
+// The empty module name is the default level.
+func WithTemporaryLogLevel(module, level string) (restore func(), err error) {
+	logLevel, err := ValidateLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := log.GetLevel(module)
+
+	log.SetLevel(module, logLevel)
+
+	return func() {
+		log.SetLevel(module, previous)
+	}, nil
+}
+
+// SetModuleLevels sets the log level of each module in levels, keyed by module name with the empty name being
+// the default level. Every level is validated before any is applied, so an invalid entry leaves all levels
+// unchanged.
+func SetModuleLevels(levels map[string]string) error {
+	modules := make([]string, 0, len(levels))
+	for module := range levels {
+		modules = append(modules, module)
+	}
+
+	sort.Strings(modules)
+
+	parsed := make(map[string]log.Level, len(levels))
+
+	for _, module := range modules {
+		logLevel, err := log.ParseLevel(levels[module])
+		if err != nil {
+			return fmt.Errorf("invalid log level %s for module %s: %w", levels[module], module, err)
+		}
+
+		parsed[module] = logLevel
+	}
+
+	for module, logLevel := range parsed {
+		log.SetLevel(module, logLevel)
+	}
+
+	return nil
+}
+
+// SetLogLevels applies a log level spec of colon-separated tokens, each either module=level or a bare level
+// for the default, such as "common=debug:storage=error:info". The whole spec is validated before any level is
+// set, so an invalid token leaves all levels unchanged.
+func SetLogLevels(spec string) error {
+	const moduleLevelParts = 2
+
+	levels := map[string]string{}
+
+	for _, token := range strings.Split(spec, ":") {
+		parts := strings.SplitN(strings.TrimSpace(token), "=", moduleLevelParts)
+
+		if len(parts) == 1 {
+			levels[""] = parts[0]
+
+			continue
+		}
+
+		if parts[0] == "" {
+			return fmt.Errorf("invalid log level spec token %q: missing module", token)
+		}
+
+		levels[parts[0]] = parts[1]
+	}
+
+	return SetModuleLevels(levels)
+}
+
+// StructuredLogger is implemented by loggers that record fields along with a message, such as adapters of JSON
+// loggers, for the options that log structured data like WithStructuredLogger.
+type StructuredLogger interface {
+	ErrorWithFields(msg string, fields map[string]interface{})
+}
+
+// InstrumentedLogger wraps logger so that each line includes the instance ID set with SetLogInstanceID.
+func InstrumentedLogger(logger log.Logger) log.Logger {
+	return &instrumentedLogger{logger: logger}
+}
+
+type instrumentedLogger struct {
+	logger log.Logger
+}
+
+func (l *instrumentedLogger) Fatalf(msg string, args ...interface{}) {
+	l.logger.Fatalf(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) Panicf(msg string, args ...interface{}) {
+	l.logger.Panicf(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) Debugf(msg string, args ...interface{}) {
+	l.logger.Debugf(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) Infof(msg string, args ...interface{}) {
+	l.logger.Infof(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) Warnf(msg string, args ...interface{}) {
+	l.logger.Warnf(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) Errorf(msg string, args ...interface{}) {
+	l.logger.Errorf(l.format(msg), args...)
+}
+
+func (l *instrumentedLogger) format(msg string) string {
+	id := instanceID()
+	if id == "" {
+		return msg
+	}
+
+	// the id becomes part of the format string, so any verbs in it must be escaped
+	return fmt.Sprintf("[instance=%s] ", strings.ReplaceAll(id, "%", "%%")) + msg
+}
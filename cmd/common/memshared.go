@@ -0,0 +1,56 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// nolint:gochecknoglobals
+var (
+	sharedMem      storage.Provider
+	sharedMemOn    bool
+	sharedMemMutex sync.Mutex
+)
+
+// UseSharedMemStore makes every mem:// connection of the process share one in-memory backend while enabled, to
+// simulate components sharing a database. Closing a shared connection leaves the backend open for the others.
+// Connections are isolated by default; disabling sharing drops the shared backend.
+func UseSharedMemStore(enabled bool) {
+	sharedMemMutex.Lock()
+	defer sharedMemMutex.Unlock()
+
+	sharedMemOn = enabled
+	sharedMem = nil
+}
+
+func newMemProvider(string, *DBParameters) (storage.Provider, error) { // nolint:unparam
+	sharedMemMutex.Lock()
+	defer sharedMemMutex.Unlock()
+
+	if !sharedMemOn {
+		return mem.NewProvider(), nil
+	}
+
+	if sharedMem == nil {
+		sharedMem = mem.NewProvider()
+	}
+
+	return &sharedMemProvider{Provider: sharedMem}, nil
+}
+
+// sharedMemProvider is a connection to the shared mem backend.
+type sharedMemProvider struct {
+	storage.Provider
+}
+
+func (p *sharedMemProvider) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseSharedMemStore(t *testing.T) {
+	connect := func(t *testing.T) storage.Store {
+		t.Helper()
+
+		p, err := InitEdgeStore(&DBParameters{URL: "mem://", Timeout: 1}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("accounts")
+		require.NoError(t, err)
+
+		return s
+	}
+
+	t.Run("isolated by default", func(t *testing.T) {
+		require.NoError(t, connect(t).Put("alice", []byte("1")))
+
+		_, err := connect(t).Get("alice")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+	})
+
+	t.Run("shared when enabled", func(t *testing.T) {
+		UseSharedMemStore(true)
+		defer UseSharedMemStore(false)
+
+		require.NoError(t, connect(t).Put("alice", []byte("1")))
+
+		p, err := InitEdgeStore(&DBParameters{URL: "mem://", Timeout: 1}, logger)
+		require.NoError(t, err)
+		require.NoError(t, p.Close())
+
+		value, err := connect(t).Get("alice")
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), value)
+	})
+
+	t.Run("disabling drops the shared backend", func(t *testing.T) {
+		UseSharedMemStore(true)
+		require.NoError(t, connect(t).Put("alice", []byte("1")))
+		UseSharedMemStore(false)
+
+		UseSharedMemStore(true)
+		defer UseSharedMemStore(false)
+
+		_, err := connect(t).Get("alice")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+	})
+}
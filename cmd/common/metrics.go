@@ -0,0 +1,219 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolMetricsInterval is the time between two publications of the pool stats by WithPoolMetrics.
+const poolMetricsInterval = 10 * time.Second
+
+// Gauge is a metric that can be set to an arbitrary value, such as a prometheus.Gauge.
+type Gauge interface {
+	Set(value float64)
+}
+
+// WithPoolMetrics registers the storage_pool_{open,idle,in_use}_connections gauges with registerer and
+// publishes in them the stats of the database handle of SQL drivers, which implement SQLDBProvider, right after
+// connecting and then periodically until the context given with WithContext is done. For the mysql driver, this
+// is the pool of the handle returned by RawSQLDB, which also runs the ping queries of the health checks. It is a
+// no-op for the other drivers.
+func WithPoolMetrics(registerer prometheus.Registerer) BuildOption {
+	return func(opts *buildOptions) {
+		opts.onConnect = append(opts.onConnect, func(p storage.Provider) error {
+			sqlProvider, ok := driverProvider(p).(SQLDBProvider)
+			if !ok {
+				return nil
+			}
+
+			gauges, err := newPoolGauges(registerer)
+			if err != nil {
+				return err
+			}
+
+			db := sqlProvider.DB()
+			gauges.publish(db.Stats())
+
+			go func() {
+				for {
+					select {
+					case <-opts.ctx.Done():
+						return
+					case <-opts.clock.After(poolMetricsInterval):
+						gauges.publish(db.Stats())
+					}
+				}
+			}()
+
+			return nil
+		})
+	}
+}
+
+type poolGauges struct {
+	open, idle, inUse Gauge
+}
+
+func newPoolGauges(registerer prometheus.Registerer) (*poolGauges, error) {
+	gauges := &poolGauges{}
+
+	for _, g := range []struct {
+		gauge      *Gauge
+		name, help string
+	}{
+		{&gauges.open, "storage_pool_open_connections", "Number of established storage connections."},
+		{&gauges.idle, "storage_pool_idle_connections", "Number of idle storage connections."},
+		{&gauges.inUse, "storage_pool_in_use_connections", "Number of storage connections in use."},
+	} {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: g.name, Help: g.help})
+
+		if err := registerer.Register(gauge); err != nil {
+			return nil, fmt.Errorf("register %s: %w", g.name, err)
+		}
+
+		*g.gauge = gauge
+	}
+
+	return gauges, nil
+}
+
+func (g *poolGauges) publish(stats sql.DBStats) {
+	g.open.Set(float64(stats.OpenConnections))
+	g.idle.Set(float64(stats.Idle))
+	g.inUse.Set(float64(stats.InUse))
+}
+
+// Counter is a metric that only increases, such as a prometheus.Counter.
+type Counter interface {
+	Inc()
+}
+
+// MetricsRegisterer creates and registers gauges and counters, which callers implement by registering a
+// prometheus.NewGauge or a prometheus.NewCounter with the given name and help on their prometheus.Registerer.
+type MetricsRegisterer interface {
+	NewGauge(name, help string) (Gauge, error)
+	NewCounter(name, help string) (Counter, error)
+}
+
+// WithLifecycleMetrics counts the connections made by the provider as storage_connects_total, the connections
+// that failed once their retries ran out as storage_connect_failures_total, and the successful connections made
+// after the first one, such as those of WithIdleClose, as storage_reconnects_total. The storage_connected gauge is
+// 1 while the provider holds a connection and 0 otherwise. BuildProvider returns the registration errors.
+func WithLifecycleMetrics(registerer MetricsRegisterer) BuildOption {
+	return func(opts *buildOptions) {
+		opts.lifecycleRegisterer = registerer
+	}
+}
+
+type lifecycleMetrics struct {
+	connects, failures, reconnects Counter
+	connected                      Gauge
+
+	mutex         sync.Mutex
+	everConnected bool
+}
+
+func newLifecycleMetrics(registerer MetricsRegisterer) (*lifecycleMetrics, error) {
+	metrics := &lifecycleMetrics{}
+
+	for _, c := range []struct {
+		counter    *Counter
+		name, help string
+	}{
+		{&metrics.connects, "storage_connects_total", "Number of successful storage connections."},
+		{&metrics.failures, "storage_connect_failures_total", "Number of failed storage connections."},
+		{&metrics.reconnects, "storage_reconnects_total", "Number of storage reconnections."},
+	} {
+		counter, err := registerer.NewCounter(c.name, c.help)
+		if err != nil {
+			return nil, fmt.Errorf("register %s: %w", c.name, err)
+		}
+
+		*c.counter = counter
+	}
+
+	gauge, err := registerer.NewGauge("storage_connected", "Whether the storage is connected.")
+	if err != nil {
+		return nil, fmt.Errorf("register storage_connected: %w", err)
+	}
+
+	metrics.connected = gauge
+	metrics.connected.Set(0)
+
+	return metrics, nil
+}
+
+// observeConnect counts a connection ending with err. It does nothing on nil metrics.
+func (m *lifecycleMetrics) observeConnect(err error) {
+	if m == nil {
+		return
+	}
+
+	if err != nil {
+		m.failures.Inc()
+
+		return
+	}
+
+	m.mutex.Lock()
+	reconnect := m.everConnected
+	m.everConnected = true
+	m.mutex.Unlock()
+
+	m.connects.Inc()
+
+	if reconnect {
+		m.reconnects.Inc()
+	}
+
+	m.connected.Set(1)
+}
+
+func (m *lifecycleMetrics) disconnected() {
+	m.connected.Set(0)
+}
+
+// registerLifecycleMetrics creates the metrics enabled by WithLifecycleMetrics.
+func (o *buildOptions) registerLifecycleMetrics() error {
+	if o.lifecycleRegisterer == nil {
+		return nil
+	}
+
+	metrics, err := newLifecycleMetrics(o.lifecycleRegisterer)
+	if err != nil {
+		return err
+	}
+
+	o.lifecycle = metrics
+
+	return nil
+}
+
+// observeDisconnects makes the lifecycle metrics, if enabled, see built closed and provider, if it is an
+// idleProvider, closing its connection.
+func (o *buildOptions) observeDisconnects(built *builtProvider, provider storage.Provider) {
+	if o.lifecycle == nil {
+		return
+	}
+
+	if idle, ok := provider.(*idleProvider); ok {
+		idle.onDisconnect = o.lifecycle.disconnected
+	}
+
+	built.addCloseHook(func() error {
+		o.lifecycle.disconnected()
+
+		return nil
+	})
+}
@@ -0,0 +1,296 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPoolMetrics(t *testing.T) {
+	t.Run("publishes the stats of the SQL database handle", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db := sql.OpenDB(&recordingConnector{})
+		t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+		registerTestDriver(t, "pooled", &sqlProvider{Provider: mem.NewProvider(), db: db})
+
+		registry := prometheus.NewRegistry()
+		clock := &manualClock{ticks: make(chan time.Time)}
+
+		_, err := BuildProvider(&DBParameters{URL: "pooled://", Timeout: 1}, logger,
+			WithContext(ctx), WithClock(clock), WithPoolMetrics(registry))
+		require.NoError(t, err)
+		require.NoError(t, comparePoolMetrics(registry, 0, 0, 0))
+
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, conn.Close()) }()
+
+		clock.ticks <- time.Now()
+
+		require.Eventually(t, func() bool {
+			return comparePoolMetrics(registry, 1, 0, 1) == nil
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("no-op for drivers without a database handle", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+
+		_, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithPoolMetrics(registry))
+		require.NoError(t, err)
+		require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(""),
+			"storage_pool_idle_connections", "storage_pool_in_use_connections", "storage_pool_open_connections"))
+	})
+
+	t.Run("registration error", func(t *testing.T) {
+		db := sql.OpenDB(&recordingConnector{})
+		t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+		registerTestDriver(t, "pooled", &sqlProvider{Provider: mem.NewProvider(), db: db})
+
+		registry := prometheus.NewRegistry()
+		require.NoError(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "storage_pool_open_connections", Help: "Number of established storage connections.",
+		})))
+
+		_, err := BuildProvider(&DBParameters{URL: "pooled://", Timeout: 1}, logger, WithPoolMetrics(registry))
+		require.EqualError(t, err,
+			"register storage_pool_open_connections: duplicate metrics collector registration attempted")
+
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		require.True(t, errors.As(err, &alreadyRegistered))
+	})
+}
+
+// comparePoolMetrics compares the pool gauges gathered from registry with the given values.
+func comparePoolMetrics(registry prometheus.Gatherer, open, idle, inUse int) error {
+	return testutil.GatherAndCompare(registry, strings.NewReader(fmt.Sprintf(`
+		# HELP storage_pool_idle_connections Number of idle storage connections.
+		# TYPE storage_pool_idle_connections gauge
+		storage_pool_idle_connections %d
+		# HELP storage_pool_in_use_connections Number of storage connections in use.
+		# TYPE storage_pool_in_use_connections gauge
+		storage_pool_in_use_connections %d
+		# HELP storage_pool_open_connections Number of established storage connections.
+		# TYPE storage_pool_open_connections gauge
+		storage_pool_open_connections %d
+	`, idle, inUse, open)),
+		"storage_pool_idle_connections", "storage_pool_in_use_connections", "storage_pool_open_connections")
+}
+
+func TestWithLifecycleMetrics(t *testing.T) {
+	t.Run("successful connect", func(t *testing.T) {
+		registerer := &fakeRegisterer{}
+
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithLifecycleMetrics(registerer))
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{
+			"storage_connects_total": 1, "storage_connect_failures_total": 0, "storage_reconnects_total": 0,
+		}, registerer.counts())
+		require.Equal(t, map[string]float64{"storage_connected": 1}, registerer.values())
+
+		require.NoError(t, p.Close())
+		require.Equal(t, map[string]float64{"storage_connected": 0}, registerer.values())
+	})
+
+	t.Run("failed connect", func(t *testing.T) {
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, errors.New("connection refused")
+		})
+
+		registerer := &fakeRegisterer{}
+
+		_, err := BuildProvider(&DBParameters{URL: "fake://localhost", Timeout: 3}, logger,
+			WithClock(newFakeClock()), WithLifecycleMetrics(registerer))
+		require.Error(t, err)
+		require.Equal(t, map[string]int{
+			"storage_connects_total": 0, "storage_connect_failures_total": 1, "storage_reconnects_total": 0,
+		}, registerer.counts())
+		require.Equal(t, map[string]float64{"storage_connected": 0}, registerer.values())
+	})
+
+	t.Run("reconnect after idle close", func(t *testing.T) {
+		counter := &connectionCounter{backend: mem.NewProvider()}
+		registerTestFactory(t, "idle", counter.connect)
+
+		registerer := &fakeRegisterer{}
+		clock := &manualClock{ticks: make(chan time.Time)}
+
+		p, err := BuildProvider(&DBParameters{URL: "idle://test", Timeout: 1}, logger,
+			WithClock(clock), WithIdleClose(time.Minute), WithLifecycleMetrics(registerer))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		clock.advance(time.Minute)
+		clock.ticks <- clock.Now()
+
+		require.Eventually(t, func() bool {
+			return registerer.values()["storage_connected"] == 0
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.Equal(t, map[string]int{
+			"storage_connects_total": 2, "storage_connect_failures_total": 0, "storage_reconnects_total": 1,
+		}, registerer.counts())
+		require.Equal(t, map[string]float64{"storage_connected": 1}, registerer.values())
+	})
+
+	t.Run("registration error", func(t *testing.T) {
+		_, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger,
+			WithLifecycleMetrics(&fakeRegisterer{err: errors.New("duplicate metrics collector")}))
+		require.EqualError(t, err, "register storage_connects_total: duplicate metrics collector")
+	})
+}
+
+type fakeRegisterer struct {
+	mutex    sync.Mutex
+	err      error
+	gauges   map[string]*fakeGauge
+	counters map[string]*fakeCounter
+}
+
+func (r *fakeRegisterer) NewCounter(name, _ string) (Counter, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.counters == nil {
+		r.counters = map[string]*fakeCounter{}
+	}
+
+	r.counters[name] = &fakeCounter{}
+
+	return r.counters[name], nil
+}
+
+func (r *fakeRegisterer) counts() map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := map[string]int{}
+
+	for name, counter := range r.counters {
+		counts[name] = counter.get()
+	}
+
+	return counts
+}
+
+func (r *fakeRegisterer) NewGauge(name, _ string) (Gauge, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.gauges == nil {
+		r.gauges = map[string]*fakeGauge{}
+	}
+
+	r.gauges[name] = &fakeGauge{}
+
+	return r.gauges[name], nil
+}
+
+func (r *fakeRegisterer) values() map[string]float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	values := map[string]float64{}
+
+	for name, gauge := range r.gauges {
+		values[name] = gauge.get()
+	}
+
+	return values
+}
+
+type fakeGauge struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (g *fakeGauge) Set(value float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.value = value
+}
+
+func (g *fakeGauge) get() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.value
+}
+
+// manualClock only moves when the test advances it, and fires the channels returned by After only when the
+// test sends on ticks.
+type manualClock struct {
+	mutex  sync.Mutex
+	offset time.Duration
+	ticks  chan time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Add(c.offset)
+}
+
+func (c *manualClock) After(time.Duration) <-chan time.Time {
+	return c.ticks
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.offset += d
+}
+
+type fakeCounter struct {
+	mutex sync.Mutex
+	value int
+}
+
+func (c *fakeCounter) Inc() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.value++
+}
+
+func (c *fakeCounter) get() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.value
+}
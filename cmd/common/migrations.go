@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// migrationsStoreName is the meta store, under the configured prefix, that records the applied migrations.
+const migrationsStoreName = "migrations"
+
+// Migration is a data migration run by RunMigrations.
+type Migration struct {
+	// ID identifies the migration. It must never change once the migration has been released.
+	ID string
+	// Apply migrates the data. It is not run again once it has succeeded.
+	Apply func(ctx context.Context, p storage.Provider) error
+}
+
+// RunMigrations applies, in order, the migrations that are not yet recorded as applied in the migrations meta
+// store, recording each as soon as it succeeds. It stops at the first migration that fails, leaving it to be
+// retried by the next run.
+func RunMigrations(ctx context.Context, p storage.Provider, params *DBParameters, migrations []Migration) error {
+	meta, err := OpenPrefixedStore(p, params, migrationsStoreName)
+	if err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = runMigration(ctx, p, meta, migration); err != nil {
+			return fmt.Errorf("run migration %s: %w", migration.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func runMigration(ctx context.Context, p storage.Provider, meta storage.Store, migration Migration) error {
+	_, err := meta.Get(migration.ID)
+	if err == nil {
+		return nil
+	}
+
+	if !IsNotFound(err) {
+		return fmt.Errorf("read migration status: %w", err)
+	}
+
+	if err = migration.Apply(ctx, p); err != nil {
+		return err
+	}
+
+	appliedAt := time.Now().UTC().Format(time.RFC3339)
+
+	if err = meta.Put(migration.ID, []byte(appliedAt), EntryTag); err != nil {
+		return fmt.Errorf("record migration: %w", err)
+	}
+
+	return nil
+}
+
+// migrationSampleSize is the number of keys listed in a MigrationReport.
+const migrationSampleSize = 10
+
+// MigrationReport describes the entries copied by Migrate.
+type MigrationReport struct {
+	// Count is the number of entries written to the destination, or that would be for a dry run.
+	Count int
+	// SampleKeys are the first keys written, in the order the source enumerated them.
+	SampleKeys []string
+}
+
+// Migrate copies the enumerable entries of source, with their tags, into destination, overwriting the entries
+// that exist there. With dryRun, source is iterated and the report is built in the same way but destination is
+// not touched, so that a migration can be previewed. It stops at the first error, or when ctx is done.
+func Migrate(ctx context.Context, source, destination storage.Store, dryRun bool) (*MigrationReport, error) {
+	report := &MigrationReport{}
+
+	err := ForEach(ctx, source, func(key string, value []byte) error {
+		if !dryRun {
+			tags, err := source.GetTags(key)
+			if err != nil {
+				return fmt.Errorf("read tags of %s: %w", truncateKey(key), err)
+			}
+
+			if err = destination.Put(key, value, withEntryTag(tags)...); err != nil {
+				return fmt.Errorf("write %s: %w", truncateKey(key), err)
+			}
+		}
+
+		report.Count++
+
+		if len(report.SampleKeys) < migrationSampleSize {
+			report.SampleKeys = append(report.SampleKeys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("migrate: %w", err)
+	}
+
+	return report, nil
+}
+
+// ErrSkipEntry is returned by the transform of CopyStore to leave an entry out of the copy.
+var ErrSkipEntry = errors.New("skip entry")
+
+// CopyStore copies the enumerable entries of src, with their tags, into dst as Migrate does, writing the value
+// returned by transform for each instead of the original, so that values can be re-encoded on the way. Entries
+// for which transform returns ErrSkipEntry are not copied; any other error of transform stops the copy. A nil
+// transform copies the values as they are.
+func CopyStore(ctx context.Context, src, dst storage.Store,
+	transform func(key string, value []byte) ([]byte, error)) error {
+	err := ForEach(ctx, src, func(key string, value []byte) error {
+		if transform != nil {
+			var err error
+
+			value, err = transform(key, value)
+			if errors.Is(err, ErrSkipEntry) {
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("transform %s: %w", truncateKey(key), err)
+			}
+		}
+
+		tags, err := src.GetTags(key)
+		if err != nil {
+			return fmt.Errorf("read tags of %s: %w", truncateKey(key), err)
+		}
+
+		if err = dst.Put(key, value, withEntryTag(tags)...); err != nil {
+			return fmt.Errorf("write %s: %w", truncateKey(key), err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("copy store: %w", err)
+	}
+
+	return nil
+}
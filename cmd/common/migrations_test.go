@@ -0,0 +1,211 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrations(t *testing.T) {
+	params := &DBParameters{Prefix: "app"}
+
+	t.Run("runs each migration once", func(t *testing.T) {
+		p := mem.NewProvider()
+		runs := map[string]int{}
+
+		migration := func(id string) Migration {
+			return Migration{ID: id, Apply: func(context.Context, storage.Provider) error {
+				runs[id]++
+
+				return nil
+			}}
+		}
+
+		require.NoError(t, RunMigrations(context.Background(), p, params, []Migration{migration("1"), migration("2")}))
+		require.NoError(t, RunMigrations(context.Background(), p, params,
+			[]Migration{migration("1"), migration("2"), migration("3")}))
+
+		require.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, runs)
+	})
+
+	t.Run("failing migration is not marked applied", func(t *testing.T) {
+		p := mem.NewProvider()
+		fail := true
+		runs := 0
+
+		migrations := []Migration{{ID: "1", Apply: func(context.Context, storage.Provider) error {
+			runs++
+
+			if fail {
+				return errors.New("boom")
+			}
+
+			return nil
+		}}}
+
+		err := RunMigrations(context.Background(), p, params, migrations)
+		require.EqualError(t, err, "run migration 1: boom")
+
+		meta, err := p.OpenStore("app_" + migrationsStoreName)
+		require.NoError(t, err)
+
+		_, err = meta.Get("1")
+		require.True(t, IsNotFound(err))
+
+		fail = false
+		require.NoError(t, RunMigrations(context.Background(), p, params, migrations))
+		require.Equal(t, 2, runs)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		migration := Migration{ID: "1", Apply: func(context.Context, storage.Provider) error {
+			t.Fatal("migration must not run")
+
+			return nil
+		}}
+
+		err := RunMigrations(ctx, mem.NewProvider(), params, []Migration{migration})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	entries := map[string]string{"a": "1", "b": "2", "c": "3"}
+
+	t.Run("dry run", func(t *testing.T) {
+		source := seededStore(t, entries)
+		destination := seededStore(t, map[string]string{"a": "old"})
+
+		report, err := Migrate(context.Background(), source, destination, true)
+		require.NoError(t, err)
+		require.Equal(t, len(entries), report.Count)
+		require.ElementsMatch(t, []string{"a", "b", "c"}, report.SampleKeys)
+
+		snap := snapshotValues(t, destination)
+		require.Equal(t, map[string][]byte{"a": []byte("old")}, snap)
+	})
+
+	t.Run("copies entries and tags", func(t *testing.T) {
+		source := seededStore(t, entries)
+		require.NoError(t, source.Put("d", []byte("4"), storage.Tag{Name: "kind", Value: "vc"}, EntryTag))
+
+		destination := seededStore(t, map[string]string{"a": "old"})
+
+		report, err := Migrate(context.Background(), source, destination, false)
+		require.NoError(t, err)
+		require.Equal(t, 4, report.Count)
+
+		equal, differing, err := EqualContents(context.Background(), &entryTaggedStore{Store: source},
+			&entryTaggedStore{Store: destination})
+		require.NoError(t, err)
+		require.True(t, equal, differing)
+
+		tags, err := destination.GetTags("d")
+		require.NoError(t, err)
+		require.Contains(t, tags, storage.Tag{Name: "kind", Value: "vc"})
+	})
+
+	t.Run("limits the sample keys", func(t *testing.T) {
+		many := map[string]string{}
+		for i := 0; i < migrationSampleSize+5; i++ {
+			many[string(rune('a'+i))] = "value"
+		}
+
+		report, err := Migrate(context.Background(), seededStore(t, many), seededStore(t, nil), true)
+		require.NoError(t, err)
+		require.Equal(t, len(many), report.Count)
+		require.Len(t, report.SampleKeys, migrationSampleSize)
+	})
+
+	t.Run("write failure", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithMaxValueSize(1))
+		require.NoError(t, err)
+
+		destination, err := p.OpenStore("destination")
+		require.NoError(t, err)
+
+		report, err := Migrate(context.Background(), seededStore(t, map[string]string{"a": "large"}), destination,
+			false)
+		require.ErrorIs(t, err, ErrValueTooLarge)
+		require.Zero(t, report.Count)
+	})
+}
+
+func TestCopyStore(t *testing.T) {
+	entries := map[string]string{"a": "1", "b": "2", "c": "3"}
+
+	t.Run("identity transform", func(t *testing.T) {
+		source := seededStore(t, entries)
+		require.NoError(t, source.Put("d", []byte("4"), storage.Tag{Name: "kind", Value: "vc"}, EntryTag))
+
+		destination := seededStore(t, map[string]string{"a": "old"})
+
+		require.NoError(t, CopyStore(context.Background(), source, destination,
+			func(_ string, value []byte) ([]byte, error) {
+				return value, nil
+			}))
+
+		equal, differing, err := EqualContents(context.Background(), &entryTaggedStore{Store: source},
+			&entryTaggedStore{Store: destination})
+		require.NoError(t, err)
+		require.True(t, equal, differing)
+
+		tags, err := destination.GetTags("d")
+		require.NoError(t, err)
+		require.Contains(t, tags, storage.Tag{Name: "kind", Value: "vc"})
+	})
+
+	t.Run("mutating transform", func(t *testing.T) {
+		destination := seededStore(t, nil)
+
+		require.NoError(t, CopyStore(context.Background(), seededStore(t, entries), destination,
+			func(key string, value []byte) ([]byte, error) {
+				return append([]byte(key+"="), value...), nil
+			}))
+
+		snap := snapshotValues(t, destination)
+		require.Equal(t, map[string][]byte{"a": []byte("a=1"), "b": []byte("b=2"), "c": []byte("c=3")}, snap)
+	})
+
+	t.Run("skips entries", func(t *testing.T) {
+		destination := seededStore(t, nil)
+
+		require.NoError(t, CopyStore(context.Background(), seededStore(t, entries), destination,
+			func(key string, value []byte) ([]byte, error) {
+				if key == "b" {
+					return nil, ErrSkipEntry
+				}
+
+				return value, nil
+			}))
+
+		snap := snapshotValues(t, destination)
+		require.Equal(t, map[string][]byte{"a": []byte("1"), "c": []byte("3")}, snap)
+	})
+
+	t.Run("transform failure", func(t *testing.T) {
+		destination := seededStore(t, nil)
+
+		err := CopyStore(context.Background(), seededStore(t, map[string]string{"a": "1"}), destination,
+			func(string, []byte) ([]byte, error) {
+				return nil, errors.New("not encodable")
+			})
+		require.EqualError(t, err, "copy store: transform a: not encodable")
+
+		snap := snapshotValues(t, destination)
+		require.Empty(t, snap)
+	})
+}
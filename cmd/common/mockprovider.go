@@ -0,0 +1,401 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// MockProvider is an in-memory storage provider for the tests of applications, whose errors, latencies and data
+// are scripted rather than following the semantics of a driver. Stores are plain maps of keys to values and tags;
+// Query matches "tag" and "tag:value" expressions, in key order, ignoring the query options. It is safe for
+// concurrent use.
+type MockProvider struct {
+	mutex     sync.Mutex
+	stores    map[string]map[string]mockEntry
+	configs   map[string]storage.StoreConfiguration
+	errs      map[string]error
+	latencies map[string]time.Duration
+	calls     map[string]int
+}
+
+type mockEntry struct {
+	value []byte
+	tags  []storage.Tag
+}
+
+// NewMockProvider returns a MockProvider with no store, error or latency.
+func NewMockProvider() *MockProvider {
+	return &MockProvider{
+		stores:    map[string]map[string]mockEntry{},
+		configs:   map[string]storage.StoreConfiguration{},
+		errs:      map[string]error{},
+		latencies: map[string]time.Duration{},
+		calls:     map[string]int{},
+	}
+}
+
+// SetError makes every call of op fail with err, without running it, until it is set to nil. op is the name of a
+// method of the storage interfaces: OpenStore, SetStoreConfig, GetStoreConfig or Close for the provider, and Put,
+// Get, GetTags, GetBulk, Query, Delete, Batch or Flush for its stores.
+func (p *MockProvider) SetError(op string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err == nil {
+		delete(p.errs, op)
+	} else {
+		p.errs[op] = err
+	}
+}
+
+// SetLatency delays every call of op, named as for SetError, by d. A latency of zero removes the delay.
+func (p *MockProvider) SetLatency(op string, d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if d <= 0 {
+		delete(p.latencies, op)
+	} else {
+		p.latencies[op] = d
+	}
+}
+
+// SetData stores value and tags under key in the store name, bypassing the scripted errors and latencies.
+func (p *MockProvider) SetData(name, key string, value []byte, tags ...storage.Tag) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.store(name)[key] = mockEntry{value: copyBytes(value), tags: append([]storage.Tag(nil), tags...)}
+}
+
+// Data returns a copy of the values of the store name, by key.
+func (p *MockProvider) Data(name string) map[string][]byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	data := map[string][]byte{}
+
+	for key, entry := range p.store(name) {
+		data[key] = copyBytes(entry.value)
+	}
+
+	return data
+}
+
+// Calls returns the number of calls of op, named as for SetError, including those that failed.
+func (p *MockProvider) Calls(op string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.calls[op]
+}
+
+// script counts a call of op, waits for its latency and returns its scripted error, if any.
+func (p *MockProvider) script(op string) error {
+	p.mutex.Lock()
+	p.calls[op]++
+	latency, err := p.latencies[op], p.errs[op]
+	p.mutex.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	return err
+}
+
+// store returns the entries of the store name, creating it if needed. It must be called with the mutex held.
+func (p *MockProvider) store(name string) map[string]mockEntry {
+	entries, ok := p.stores[name]
+	if !ok {
+		entries = map[string]mockEntry{}
+		p.stores[name] = entries
+	}
+
+	return entries
+}
+
+// OpenStore implements storage.Provider.
+func (p *MockProvider) OpenStore(name string) (storage.Store, error) {
+	if err := p.script("OpenStore"); err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.store(name)
+	p.mutex.Unlock()
+
+	return &mockProviderStore{provider: p, name: name}, nil
+}
+
+// SetStoreConfig implements storage.Provider.
+func (p *MockProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	if err := p.script("SetStoreConfig"); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.configs[name] = config
+
+	return nil
+}
+
+// GetStoreConfig implements storage.Provider.
+func (p *MockProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	if err := p.script("GetStoreConfig"); err != nil {
+		return storage.StoreConfiguration{}, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	config, ok := p.configs[name]
+	if !ok {
+		return storage.StoreConfiguration{}, storage.ErrStoreNotFound
+	}
+
+	return config, nil
+}
+
+// GetOpenStores implements storage.Provider, returning the stores in name order.
+func (p *MockProvider) GetOpenStores() []storage.Store {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.stores))
+	for name := range p.stores {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	stores := make([]storage.Store, len(names))
+	for i, name := range names {
+		stores[i] = &mockProviderStore{provider: p, name: name}
+	}
+
+	return stores
+}
+
+// Close implements storage.Provider. The data is kept, so that tests can inspect it after the provider is closed.
+func (p *MockProvider) Close() error {
+	return p.script("Close")
+}
+
+type mockProviderStore struct {
+	provider *MockProvider
+	name     string
+}
+
+// do runs fn on the entries of the store once op passed its script, with the mutex of the provider held.
+func (s *mockProviderStore) do(op string, fn func(entries map[string]mockEntry) error) error {
+	if err := s.provider.script(op); err != nil {
+		return err
+	}
+
+	s.provider.mutex.Lock()
+	defer s.provider.mutex.Unlock()
+
+	return fn(s.provider.store(s.name))
+}
+
+func (s *mockProviderStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.do("Put", func(entries map[string]mockEntry) error {
+		entries[key] = mockEntry{value: copyBytes(value), tags: append([]storage.Tag(nil), tags...)}
+
+		return nil
+	})
+}
+
+func (s *mockProviderStore) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := s.do("Get", func(entries map[string]mockEntry) error {
+		entry, ok := entries[key]
+		if !ok {
+			return storage.ErrDataNotFound
+		}
+
+		value = copyBytes(entry.value)
+
+		return nil
+	})
+
+	return value, err
+}
+
+func (s *mockProviderStore) GetTags(key string) ([]storage.Tag, error) {
+	var tags []storage.Tag
+
+	err := s.do("GetTags", func(entries map[string]mockEntry) error {
+		entry, ok := entries[key]
+		if !ok {
+			return storage.ErrDataNotFound
+		}
+
+		tags = append([]storage.Tag(nil), entry.tags...)
+
+		return nil
+	})
+
+	return tags, err
+}
+
+func (s *mockProviderStore) GetBulk(keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+
+	err := s.do("GetBulk", func(entries map[string]mockEntry) error {
+		for i, key := range keys {
+			if entry, ok := entries[key]; ok {
+				values[i] = copyBytes(entry.value)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s *mockProviderStore) Query(expression string, _ ...storage.QueryOption) (storage.Iterator, error) {
+	const tagParts = 2
+
+	var matches []mockIteratorEntry
+
+	err := s.do("Query", func(entries map[string]mockEntry) error {
+		parts := strings.SplitN(expression, ":", tagParts)
+		if parts[0] == "" {
+			return fmt.Errorf("invalid query expression %q", expression)
+		}
+
+		for key, entry := range entries {
+			for _, tag := range entry.tags {
+				if tag.Name == parts[0] && (len(parts) == 1 || tag.Value == parts[1]) {
+					matches = append(matches, mockIteratorEntry{key: key, mockEntry: entry})
+
+					break
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].key < matches[j].key
+	})
+
+	return &mockIterator{entries: matches, current: -1}, nil
+}
+
+func (s *mockProviderStore) Delete(key string) error {
+	return s.do("Delete", func(entries map[string]mockEntry) error {
+		delete(entries, key)
+
+		return nil
+	})
+}
+
+// Batch applies operations at once, so that a scripted error leaves the store unchanged.
+func (s *mockProviderStore) Batch(operations []storage.Operation) error {
+	return s.do("Batch", func(entries map[string]mockEntry) error {
+		for _, op := range operations {
+			if op.Value == nil {
+				delete(entries, op.Key)
+
+				continue
+			}
+
+			entries[op.Key] = mockEntry{value: copyBytes(op.Value), tags: append([]storage.Tag(nil), op.Tags...)}
+		}
+
+		return nil
+	})
+}
+
+func (s *mockProviderStore) Flush() error {
+	return s.provider.script("Flush")
+}
+
+func (s *mockProviderStore) Close() error {
+	return nil
+}
+
+type mockIteratorEntry struct {
+	key string
+	mockEntry
+}
+
+type mockIterator struct {
+	entries []mockIteratorEntry
+	current int
+}
+
+func (i *mockIterator) Next() (bool, error) {
+	if i.current < len(i.entries) {
+		i.current++
+	}
+
+	return i.current < len(i.entries), nil
+}
+
+func (i *mockIterator) entry() (mockIteratorEntry, error) {
+	if i.current < 0 || i.current >= len(i.entries) {
+		return mockIteratorEntry{}, storage.ErrDataNotFound
+	}
+
+	return i.entries[i.current], nil
+}
+
+func (i *mockIterator) Key() (string, error) {
+	entry, err := i.entry()
+
+	return entry.key, err
+}
+
+func (i *mockIterator) Value() ([]byte, error) {
+	entry, err := i.entry()
+
+	return copyBytes(entry.value), err
+}
+
+func (i *mockIterator) Tags() ([]storage.Tag, error) {
+	entry, err := i.entry()
+
+	return append([]storage.Tag(nil), entry.tags...), err
+}
+
+func (i *mockIterator) TotalItems() (int, error) {
+	return len(i.entries), nil
+}
+
+func (i *mockIterator) Close() error {
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
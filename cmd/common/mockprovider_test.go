@@ -0,0 +1,120 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMockProvider(t *testing.T) {
+	t.Run("data round trip", func(t *testing.T) {
+		p := NewMockProvider()
+		p.SetData("store", "seeded", []byte("1"), EntryTag)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		v, err := s.Get("seeded")
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), v)
+
+		require.NoError(t, s.Put("written", []byte("2"), EntryTag, storage.Tag{Name: "kind", Value: "b"}))
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "batched", Value: []byte("3")}, {Key: "seeded"}}))
+		require.Equal(t, map[string][]byte{"written": []byte("2"), "batched": []byte("3")}, p.Data("store"))
+
+		tags, err := s.GetTags("written")
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{EntryTag, {Name: "kind", Value: "b"}}, tags)
+
+		values, err := s.GetBulk("written", "missing")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("2"), nil}, values)
+
+		snap := snapshotValues(t, s)
+		require.Equal(t, map[string][]byte{"written": []byte("2")}, snap)
+
+		iterator, err := s.Query("kind:b")
+		require.NoError(t, err)
+
+		key, _, more, err := nextEntry(iterator)
+		require.NoError(t, err)
+		require.True(t, more)
+		require.Equal(t, "written", key)
+
+		require.NoError(t, s.Delete("written"))
+
+		_, err = s.Get("written")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		require.Equal(t, 2, p.Calls("Get"))
+	})
+
+	t.Run("scripted errors", func(t *testing.T) {
+		p := NewMockProvider()
+		unavailable := errors.New("unavailable")
+
+		p.SetError("OpenStore", unavailable)
+
+		_, err := p.OpenStore("store")
+		require.Equal(t, unavailable, err)
+
+		p.SetError("OpenStore", nil)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		p.SetError("Put", unavailable)
+		require.Equal(t, unavailable, s.Put("key", []byte("value")))
+		require.Empty(t, p.Data("store"))
+		require.Equal(t, 1, p.Calls("Put"))
+
+		p.SetError("Put", nil)
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		p.SetError("Get", unavailable)
+
+		_, err = s.Get("key")
+		require.Equal(t, unavailable, err)
+
+		p.SetError("Close", unavailable)
+		require.Equal(t, unavailable, p.Close())
+	})
+
+	t.Run("scripted latency", func(t *testing.T) {
+		const latency = 20 * time.Millisecond
+
+		p := NewMockProvider()
+		p.SetLatency("Get", latency)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		require.True(t, errors.Is(healthCheck(ctx, p, "store", DatabasePingQueryDefault), context.DeadlineExceeded))
+
+		started := time.Now()
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		require.GreaterOrEqual(t, int64(time.Since(started)), int64(latency))
+
+		p.SetLatency("Get", 0)
+
+		started = time.Now()
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		require.Less(t, int64(time.Since(started)), int64(latency))
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+)
+
+// nolint:gochecknoglobals
+var (
+	profiles = map[string]map[string]string{
+		"local": {
+			DatabaseTimeoutEnvKey: "5",
+		},
+		"ci": {
+			DatabaseTimeoutEnvKey: "60",
+		},
+		"prod": {
+			DatabaseTimeoutEnvKey:     "120",
+			DatabaseRetryJitterEnvKey: "true",
+		},
+	}
+	profilesMutex sync.RWMutex
+)
+
+// RegisterProfile adds or replaces the named profile selectable with DatabaseProfileEnvKey. defaults maps
+// environment variables, such as DatabaseTimeoutEnvKey, to the values used when they are not set. The built-in
+// profiles are local, ci and prod.
+func RegisterProfile(name string, defaults map[string]string) {
+	profile := make(map[string]string, len(defaults))
+	for key, value := range defaults {
+		profile[key] = value
+	}
+
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	profiles[name] = profile
+}
+
+// readDBProfile sets the defaults of the selected profile into the environment for the variables that are not
+// set, so that explicit values, from the environment or the configuration files, always win.
+func readDBProfile(cmd *cobra.Command, _ *DBParameters) error {
+	name := cmdutils.GetUserSetOptionalVarFromString(cmd, DatabaseProfileFlagName, DatabaseProfileEnvKey)
+	if name == "" {
+		return nil
+	}
+
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("failed to configure dbProfile: unknown profile %s, known profiles are %s",
+			name, strings.Join(profileNames(), ", "))
+	}
+
+	for key, value := range profile {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to configure dbProfile: set %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// profileNames returns the sorted names of the profiles. The caller holds profilesMutex.
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,69 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiles(t *testing.T) {
+	params := func(t *testing.T, profile string) (*DBParameters, error) {
+		t.Helper()
+
+		require.NoError(t, os.Setenv(DatabaseURLEnvKey, "mem://test"))
+		require.NoError(t, os.Setenv(DatabasePrefixEnvKey, "app"))
+		require.NoError(t, os.Setenv(DatabaseProfileEnvKey, profile))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		return DBParams(cmd)
+	}
+
+	t.Run("prod raises the default timeout", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		result, err := params(t, "prod")
+		require.NoError(t, err)
+		require.Greater(t, result.Timeout, uint64(DatabaseTimeoutDefault))
+		require.True(t, result.RetryJitter)
+	})
+
+	t.Run("explicit value overrides the profile", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		require.NoError(t, os.Setenv(DatabaseTimeoutEnvKey, "7"))
+
+		result, err := params(t, "prod")
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), result.Timeout)
+	})
+
+	t.Run("custom profile", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		RegisterProfile("staging", map[string]string{DatabaseStoreNameEnvKey: "staging"})
+		defer delete(profiles, "staging")
+
+		result, err := params(t, "staging")
+		require.NoError(t, err)
+		require.Equal(t, "staging", result.StoreName)
+		require.Equal(t, uint64(DatabaseTimeoutDefault), result.Timeout)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		_, err := params(t, "qa")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown profile qa, known profiles are ci, local, prod")
+	})
+}
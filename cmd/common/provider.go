@@ -0,0 +1,1308 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// BuildOption configures the provider returned by BuildProvider.
+type BuildOption func(opts *buildOptions)
+
+// healthPollInterval is the time waited between health checks by WithWaitForHealthy.
+const healthPollInterval = time.Second
+
+type buildOptions struct {
+	ctx             context.Context
+	clock           Clock
+	rand            *rand.Rand
+	waitForHealthy  time.Duration
+	healthRetryable func(err error) bool
+	replicaURL      string
+	idleClose       time.Duration
+	lazyConnect     bool
+	history         *operationHistory
+	access          *accessTracker
+	changes         *changeFeed
+	onConnect       []func(p storage.Provider) error
+	wrappers        []func(p storage.Provider) storage.Provider
+	entryTagging    bool
+
+	connectObserver   func(attempt int, url string, err error)
+	retryable         func(err error) bool
+	rateLimitFailFast bool
+	structuredLogger  StructuredLogger
+
+	lifecycleRegisterer MetricsRegisterer
+	lifecycle           *lifecycleMetrics
+
+	storeTimeouts *storeTimeouts
+}
+
+// WithClock sets the clock used by the polling and retry loops. Defaults to the system clock.
+func WithClock(clock Clock) BuildOption {
+	return func(opts *buildOptions) {
+		opts.clock = clock
+	}
+}
+
+// WithRandSource sets the source of the connection retry jitter enabled by DBParameters.RetryJitter, so that a
+// fixed seed gives a reproducible schedule. Defaults to a source seeded with the current time.
+func WithRandSource(src rand.Source) BuildOption {
+	return func(opts *buildOptions) {
+		opts.rand = rand.New(src) // nolint:gosec
+	}
+}
+
+// WithConnectObserver calls fn after every connection attempt made by BuildProvider with the attempt number,
+// starting at 1, the masked URL and the error of the attempt, nil for the one that succeeds.
+func WithConnectObserver(fn func(attempt int, url string, err error)) BuildOption {
+	return func(opts *buildOptions) {
+		opts.connectObserver = fn
+	}
+}
+
+// WithRetryPredicate makes BuildProvider retry only the connection errors for which fn returns true, instead of
+// every error but a driver panic, so that drivers or proxies with their own transient errors can be kept
+// retrying while other errors fail at once.
+func WithRetryPredicate(fn func(err error) bool) BuildOption {
+	return func(opts *buildOptions) {
+		opts.retryable = fn
+	}
+}
+
+// WithWaitForHealthy makes BuildProvider poll HealthCheck after connecting until it passes, failing if the
+// provider is still unhealthy once timeout elapses. Both a backend telling it is not ready yet, with an error
+// matching ErrNotReady, and a probe that fails are checked again until then.
+func WithWaitForHealthy(timeout time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		opts.waitForHealthy = timeout
+	}
+}
+
+// WithHealthRetryPredicate sets which errors of a failed probe WithWaitForHealthy checks again after, fn
+// returning false for the errors that fail BuildProvider at once. A backend that is not ready yet is always
+// checked again. The default checks again after every error.
+func WithHealthRetryPredicate(fn func(err error) bool) BuildOption {
+	return func(opts *buildOptions) {
+		opts.healthRetryable = fn
+	}
+}
+
+// WithContext sets the context that bounds blocking waits done by the provider wrappers.
+// Defaults to context.Background().
+func WithContext(ctx context.Context) BuildOption {
+	return func(opts *buildOptions) {
+		opts.ctx = ctx
+	}
+}
+
+// WithConcurrencyLimit bounds the number of in-flight store operations to n. Callers block until a slot
+// frees up or the provider context is done. A limit of zero or less disables the limiter.
+func WithConcurrencyLimit(n int) BuildOption {
+	return func(opts *buildOptions) {
+		if n <= 0 {
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return interceptStores(p, concurrencyLimiter(opts.ctx, n))
+		})
+	}
+}
+
+// WithOperationTimeout aborts store operations that take longer than d, returning an error wrapping
+// context.DeadlineExceeded. When the provider context set with WithContext has a deadline, that deadline bounds
+// the operations instead. An aborted operation is abandoned, not cancelled: the driver call keeps running in the
+// background. The stores given a timeout of their own, with WithStoreTimeouts or OpenPrefixedStoreWithTimeout,
+// use it instead of d. A timeout of zero or less disables the option for the other stores.
+func WithOperationTimeout(d time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		timeouts := opts.timeouts()
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			timeouts.enable()
+
+			return interceptStores(p, operationTimeout(opts.ctx, d, timeouts))
+		})
+	}
+}
+
+// WithStoreTimeouts gives the stores named in timeouts, as opened on the provider, prefix included, their own
+// operation timeout, which overrides that of WithOperationTimeout. It has no effect without WithOperationTimeout.
+func WithStoreTimeouts(timeouts map[string]time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		for name, d := range timeouts {
+			opts.timeouts().set(name, d)
+		}
+	}
+}
+
+// OperationContext returns a context derived from parent that is done after the timeout of params, in seconds,
+// or DatabaseTimeoutDefault seconds when it is not set, so that callers bound their store operations like
+// connections are. The returned cancel function must be called once the operations are done.
+func OperationContext(parent context.Context, params *DBParameters) (context.Context, context.CancelFunc) {
+	timeout := params.Timeout
+	if timeout == 0 {
+		timeout = DatabaseTimeoutDefault
+	}
+
+	return context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+}
+
+// WithErrorContext annotates errors returned by store operations with the operation, the store name and
+// the key. Long keys are truncated so that sensitive identifiers are not written to logs in full. With
+// WithStructuredLogger, the annotated errors are also logged with their fields.
+func WithErrorContext() BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			if opts.structuredLogger == nil {
+				return interceptStores(p, errorContext)
+			}
+
+			return interceptStores(p, loggedErrorContext(opts.structuredLogger, opts.clock))
+		})
+	}
+}
+
+// WithStructuredLogger logs the store operation errors annotated WithErrorContext through logger, with the
+// fields "operation", "store", "key", truncated as in the error, "duration", a time.Duration timed on the clock
+// given with WithClock, and "error", so that log processors can filter on them.
+func WithStructuredLogger(logger StructuredLogger) BuildOption {
+	return func(opts *buildOptions) {
+		opts.structuredLogger = logger
+	}
+}
+
+// ErrInvalidKey is returned by providers built WithUTF8KeyValidation for keys that are not valid UTF-8.
+var ErrInvalidKey = errors.New("invalid key")
+
+// WithUTF8KeyValidation rejects Put, Get, GetTags and Delete calls whose key is not valid UTF-8 with
+// ErrInvalidKey, before they reach the backend, as binary keys can corrupt the indexes of drivers such as
+// CouchDB.
+func WithUTF8KeyValidation() BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return interceptStores(p, validateUTF8Key)
+		})
+	}
+}
+
+// WithEntryTagging adds EntryTag to every value written through the provider so that the store helpers,
+// such as ForEach and StoreStats, can enumerate it.
+func WithEntryTagging() BuildOption {
+	return func(opts *buildOptions) {
+		opts.entryTagging = true
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &entryTaggingStore{Store: s}
+			})
+		})
+	}
+}
+
+// ErrValueTooLarge is returned when a value exceeds the size allowed by WithMaxValueSize.
+var ErrValueTooLarge = errors.New("value too large")
+
+// WithMaxValueSize rejects values larger than n bytes with ErrValueTooLarge. A limit of zero or less disables
+// the check. BuildProvider applies DBParameters.MaxValueSize with this option.
+func WithMaxValueSize(n int) BuildOption {
+	return func(opts *buildOptions) {
+		if n <= 0 {
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &maxValueSizeStore{Store: s, maxSize: n}
+			})
+		})
+	}
+}
+
+// ErrTooManyStores is returned when opening a store would exceed the number allowed by WithMaxStores.
+var ErrTooManyStores = errors.New("too many stores")
+
+// WithMaxStores allows at most n distinct stores to be opened through the provider, failing further ones with
+// ErrTooManyStores. Reopening a store already counted is always allowed. A limit of zero or less disables the
+// check. BuildProvider applies DBParameters.MaxStores with this option.
+func WithMaxStores(n int) BuildOption {
+	return func(opts *buildOptions) {
+		if n <= 0 {
+			return
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return &maxStoresProvider{Provider: p, maxStores: n, opened: map[string]bool{}}
+		})
+	}
+}
+
+const (
+	// ExpiryTagName is the tag holding the expiry time, in Unix nanoseconds, of values written through a
+	// provider built WithTTL.
+	ExpiryTagName = "expiry"
+
+	ttlTagName = "ttl"
+)
+
+// TTLTag overrides the default time-to-live of WithTTL for a single Put.
+func TTLTag(ttl time.Duration) storage.Tag {
+	return storage.Tag{Name: ttlTagName, Value: ttl.String()}
+}
+
+// WithTTL expires values ttl after they are written, or after the duration of their TTLTag if one is given.
+// Expired values are reported as storage.ErrDataNotFound by Get and GetBulk and are deleted as they are found.
+// Query results are not filtered. A ttl of zero or less only expires values that carry a TTLTag.
+func WithTTL(ttl time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &ttlStore{Store: s, ttl: ttl, clock: opts.clock}
+			})
+		})
+	}
+}
+
+// readAfterWriteInterval is the time waited between reads retried by WithReadAfterWriteRetry.
+const readAfterWriteInterval = 100 * time.Millisecond
+
+// WithReadAfterWriteRetry retries a Get that reports storage.ErrDataNotFound for a key written through the
+// same store less than window ago, for up to the rest of the window. This hides the eventual consistency of
+// backends such as CouchDB from code that reads its own writes.
+func WithReadAfterWriteRetry(window time.Duration) BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &readAfterWriteStore{Store: s, window: window, clock: opts.clock, writes: map[string]time.Time{}}
+			})
+		})
+	}
+}
+
+// WithSingleFlight coalesces concurrent Get calls for the same key of a store into one backend read whose
+// result is shared by all the callers, which protects backends such as CouchDB from cache stampedes.
+func WithSingleFlight() BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(_ string, s storage.Store) storage.Store {
+				return &singleFlightStore{Store: s, calls: map[string]*flightCall{}}
+			})
+		})
+	}
+}
+
+// WithBootstrap runs fn once on the provider after BuildProvider connects, before any wrapper is applied, to do
+// one-time setup such as creating indexes. An error from fn aborts BuildProvider.
+func WithBootstrap(fn func(p storage.Provider) error) BuildOption {
+	return func(opts *buildOptions) {
+		opts.onConnect = append(opts.onConnect, func(p storage.Provider) error {
+			if err := fn(p); err != nil {
+				return fmt.Errorf("bootstrap storage: %w", err)
+			}
+
+			return nil
+		})
+	}
+}
+
+// WithIndexes creates the indexes for the given tag names of each store once BuildProvider connects, by opening
+// the store and setting its configuration, which is how the CouchDB and SQL drivers create their indexes. Stores
+// are configured in name order and the first error aborts BuildProvider.
+func WithIndexes(indexes map[string][]string) BuildOption {
+	return func(opts *buildOptions) {
+		opts.onConnect = append(opts.onConnect, func(p storage.Provider) error {
+			names := make([]string, 0, len(indexes))
+			for name := range indexes {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			for _, name := range names {
+				if err := createIndexes(p, name, indexes[name]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+}
+
+func createIndexes(p storage.Provider, name string, tagNames []string) error {
+	if _, err := p.OpenStore(name); err != nil {
+		return fmt.Errorf("create indexes for %s: open store: %w", name, err)
+	}
+
+	if err := p.SetStoreConfig(name, storage.StoreConfiguration{TagNames: tagNames}); err != nil {
+		return fmt.Errorf("create indexes for %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// WithAuditLog logs an INFO line for every Put and Delete made through the provider, including those in a
+// Batch, with the store, the truncated key, the value size and the outcome. Values and reads are never logged.
+func WithAuditLog(logger log.Logger) BuildOption {
+	return func(opts *buildOptions) {
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			return wrapStores(p, func(name string, s storage.Store) storage.Store {
+				return &auditStore{Store: s, name: name, logger: logger}
+			})
+		})
+	}
+}
+
+// BuildProvider connects to the storage configured in params, as InitEdgeStore does but waiting on the clock
+// given with WithClock between attempts, and decorates the resulting provider with the given options. Wrappers
+// are applied in order, so the last option is outermost.
+func BuildProvider(params *DBParameters, logger log.Logger, opts ...BuildOption) (storage.Provider, error) {
+	options := &buildOptions{ctx: context.Background(), clock: systemClock{}}
+
+	defaults := []BuildOption{
+		WithMaxValueSize(params.MaxValueSize), WithMaxStores(params.MaxStores), WithReadReplica(params.ReplicaURL),
+		withCompatMode(params),
+	}
+
+	for _, opt := range append(defaults, opts...) {
+		opt(options)
+	}
+
+	if options.rand == nil {
+		options.rand = newRetryRand()
+	}
+
+	if err := options.registerLifecycleMetrics(); err != nil {
+		return nil, err
+	}
+
+	var provider, conn storage.Provider
+
+	if options.lazyConnect {
+		provider = newLazyProvider(params, logger, options)
+	} else {
+		connected, err := connectAndPrepare(params, logger, options)
+		if err != nil {
+			return nil, err
+		}
+
+		provider, conn = connected, connected
+
+		if options.idleClose > 0 {
+			conn = nil
+			provider = newIdleProvider(provider, options.idleClose, options.clock, func() (storage.Provider, error) {
+				return connectPrimaryAndReplica(params, logger, options)
+			})
+		}
+	}
+
+	built := &builtProvider{
+		Provider:        options.wrap(provider),
+		healthStoreName: healthStoreName(params),
+		pingQueryText:   pingQuery(params),
+		capabilities:    driverCapabilities[driverName(params)],
+		storeTimeouts:   options.storeTimeouts,
+		changes:         options.changes,
+		conn:            conn,
+		entryTagging:    options.entryTagging,
+	}
+
+	if options.changes != nil {
+		built.addCloseHook(options.changes.close)
+	}
+
+	options.observeDisconnects(built, provider)
+
+	return options.expose(built), nil
+}
+
+// connectAndPrepare connects to the storage of params, then waits for it to be healthy and runs the connection
+// hooks as configured by options.
+func connectAndPrepare(params *DBParameters, logger log.Logger, options *buildOptions) (storage.Provider, error) {
+	provider, err := connectPrimaryAndReplica(params, logger, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.waitForHealthy > 0 {
+		if err = options.awaitHealthy(provider, params); err != nil {
+			return nil, closeOnFailure(provider, err)
+		}
+	}
+
+	for _, hook := range options.onConnect {
+		if err = hook(provider); err != nil {
+			return nil, closeOnFailure(provider, err)
+		}
+	}
+
+	return provider, nil
+}
+
+// closeOnFailure closes the provider that failed to be prepared with err, returning err together with the error
+// of the close, if any.
+func closeOnFailure(provider storage.Provider, err error) error {
+	if closeErr := provider.Close(); closeErr != nil {
+		return multiError{err, fmt.Errorf("close storage: %w", closeErr)}
+	}
+
+	return err
+}
+
+// HealthCheck verifies that p can serve requests by opening a sentinel store and reading from it. The store is
+// DBParameters.HealthStore for providers returned by BuildProvider, DatabaseHealthStoreDefault otherwise. For
+// SQL databases, as told by RawSQLDB, the ping query, DBParameters.PingQuery or DatabasePingQueryDefault, is run
+// first. The probe is abandoned with the error of ctx once ctx is done, so that its deadline bounds the check
+// however slow the backend is.
+func HealthCheck(ctx context.Context, p storage.Provider) error {
+	storeName, query := healthProbeOf(p)
+
+	return healthCheck(ctx, p, storeName, query)
+}
+
+func healthCheck(ctx context.Context, p storage.Provider, storeName, query string) error {
+	result := make(chan error, 1)
+
+	go func() {
+		result <- probe(ctx, p, storeName, query)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check: %w", ctx.Err())
+	}
+}
+
+// HealthCheckTimeout runs HealthCheck with a deadline of timeout from now.
+func HealthCheckTimeout(p storage.Provider, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return HealthCheck(ctx, p)
+}
+
+// healthProber is implemented by the providers returned by BuildProvider.
+type healthProber interface {
+	healthStore() string
+	pingQuery() string
+}
+
+// healthProbeOf returns the health store and the ping query of p.
+func healthProbeOf(p storage.Provider) (string, string) {
+	if prober, ok := p.(healthProber); ok {
+		return prober.healthStore(), prober.pingQuery()
+	}
+
+	return DatabaseHealthStoreDefault, DatabasePingQueryDefault
+}
+
+// healthStoreName returns the store opened by the health checks of providers built with params.
+func healthStoreName(params *DBParameters) string {
+	if params.HealthStore == "" {
+		return DatabaseHealthStoreDefault
+	}
+
+	return params.HealthStore
+}
+
+// pingQuery returns the query run by the health checks of the SQL databases of providers built with params.
+func pingQuery(params *DBParameters) string {
+	if params.PingQuery == "" {
+		return DatabasePingQueryDefault
+	}
+
+	return params.PingQuery
+}
+
+func probe(ctx context.Context, p storage.Provider, storeName, query string) error {
+	if db, sqlErr := RawSQLDB(p); sqlErr == nil {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("health check: ping query: %w", err)
+		}
+
+		_ = rows.Close() // nolint:errcheck
+	}
+
+	store, err := p.OpenStore(storeName)
+	if err != nil {
+		return fmt.Errorf("health check: open store: %w", notReady(err))
+	}
+
+	_, err = store.Get(storeName)
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("health check: read store: %w", notReady(err))
+	}
+
+	return nil
+}
+
+// awaitHealthy polls the health check of p until it passes or, with an error, the timeout of WithWaitForHealthy
+// elapses, which also bounds each probe. A backend that is not ready yet is polled until then, as is a probe that
+// fails unless the predicate of WithHealthRetryPredicate rejects its error. The wait stops with the provider
+// context.
+func (o *buildOptions) awaitHealthy(p storage.Provider, params *DBParameters) error {
+	deadline := o.clock.Now().Add(o.waitForHealthy)
+
+	for {
+		// the remaining time is measured on the clock, which may not be the system's
+		probeCtx, cancel := context.WithTimeout(o.ctx, deadline.Sub(o.clock.Now()))
+		err := healthCheck(probeCtx, p, healthStoreName(params), pingQuery(params))
+
+		cancel()
+
+		switch {
+		case err == nil:
+			return nil
+		case o.ctx.Err() != nil:
+			return fmt.Errorf("storage not healthy: %w, last check: %s", o.ctx.Err(), err)
+		case !errors.Is(err, ErrNotReady) && o.healthRetryable != nil && !o.healthRetryable(err):
+			return fmt.Errorf("storage not healthy: %w", err)
+		case !o.clock.Now().Before(deadline):
+			return fmt.Errorf("storage not healthy after %s: %w", o.waitForHealthy, err)
+		}
+
+		packageLogger().Debugf("storage not healthy yet, checking again in %s: %s", healthPollInterval,
+			redactSecrets(params, err.Error()))
+
+		select {
+		case <-o.ctx.Done():
+			return fmt.Errorf("storage not healthy: %w, last check: %s", o.ctx.Err(), err)
+		case <-o.clock.After(healthPollInterval):
+		}
+
+		if !o.clock.Now().Before(deadline) {
+			return fmt.Errorf("storage not healthy after %s: %w", o.waitForHealthy, err)
+		}
+	}
+}
+
+func (o *buildOptions) wrap(p storage.Provider) storage.Provider {
+	for _, wrapper := range o.wrappers {
+		p = wrapper(p)
+	}
+
+	return p
+}
+
+func (o *buildOptions) connectHooks() connectHooks {
+	return connectHooks{observe: o.connectObserver, retryable: o.retryable}
+}
+
+// expose returns built with the reporting interfaces, such as HistoryReporter, of the options that enable them.
+func (o *buildOptions) expose(built *builtProvider) storage.Provider {
+	switch {
+	case o.history != nil && o.access != nil:
+		return &historyAccessTrackingProvider{builtProvider: built, operationHistory: o.history, accessTracker: o.access}
+	case o.history != nil:
+		return &historyProvider{builtProvider: built, operationHistory: o.history}
+	case o.access != nil:
+		return &accessTrackingProvider{builtProvider: built, accessTracker: o.access}
+	default:
+		return built
+	}
+}
+
+type storeWrappingProvider struct {
+	storage.Provider
+	wrapStore func(name string, s storage.Store) storage.Store
+}
+
+// wrapStores decorates every store opened through p with wrapStore.
+func wrapStores(p storage.Provider, wrapStore func(name string, s storage.Store) storage.Store) storage.Provider {
+	return &storeWrappingProvider{Provider: p, wrapStore: wrapStore}
+}
+
+func (p *storeWrappingProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.wrapStore(name, store), nil
+}
+
+type entryTaggingStore struct {
+	storage.Store
+}
+
+func (s *entryTaggingStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.Store.Put(key, value, withEntryTag(tags)...)
+}
+
+func (s *entryTaggingStore) Batch(operations []storage.Operation) error {
+	tagged := make([]storage.Operation, len(operations))
+
+	for i, op := range operations {
+		tagged[i] = op
+
+		if op.Value != nil {
+			tagged[i].Tags = withEntryTag(op.Tags)
+		}
+	}
+
+	return s.Store.Batch(tagged)
+}
+
+type maxStoresProvider struct {
+	storage.Provider
+	maxStores int
+
+	mutex  sync.Mutex
+	opened map[string]bool
+}
+
+func (p *maxStoresProvider) OpenStore(name string) (storage.Store, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.opened[name] && len(p.opened) >= p.maxStores {
+		return nil, fmt.Errorf("%w: opening %s would exceed the limit of %d", ErrTooManyStores, name, p.maxStores)
+	}
+
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.opened[name] = true
+
+	return store, nil
+}
+
+type maxValueSizeStore struct {
+	storage.Store
+	maxSize int
+}
+
+func (s *maxValueSizeStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if err := s.check(key, value); err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *maxValueSizeStore) Batch(operations []storage.Operation) error {
+	for _, op := range operations {
+		if err := s.check(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Batch(operations)
+}
+
+func (s *maxValueSizeStore) check(key string, value []byte) error {
+	if len(value) > s.maxSize {
+		return fmt.Errorf("%w: %d bytes for key %s exceeds the limit of %d bytes",
+			ErrValueTooLarge, len(value), truncateKey(key), s.maxSize)
+	}
+
+	return nil
+}
+
+type auditStore struct {
+	storage.Store
+	name   string
+	logger log.Logger
+}
+
+func (s *auditStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	err := s.Store.Put(key, value, tags...)
+	s.audit("put", key, len(value), err)
+
+	return err
+}
+
+func (s *auditStore) Delete(key string) error {
+	err := s.Store.Delete(key)
+	s.audit("delete", key, 0, err)
+
+	return err
+}
+
+func (s *auditStore) Batch(operations []storage.Operation) error {
+	err := s.Store.Batch(operations)
+
+	for _, op := range operations {
+		if op.Value == nil {
+			s.audit("delete", op.Key, 0, err)
+		} else {
+			s.audit("put", op.Key, len(op.Value), err)
+		}
+	}
+
+	return err
+}
+
+func (s *auditStore) audit(op, key string, size int, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+
+	s.logger.Infof("audit op=%s store=%s key=%s size=%d result=%s", op, s.name, truncateKey(key), size, result)
+}
+
+type ttlStore struct {
+	storage.Store
+	ttl   time.Duration
+	clock Clock
+}
+
+func (s *ttlStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	tags, err := s.expiryTags(tags)
+	if err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *ttlStore) Batch(operations []storage.Operation) error {
+	expiring := make([]storage.Operation, len(operations))
+
+	for i, op := range operations {
+		expiring[i] = op
+
+		if op.Value == nil {
+			continue
+		}
+
+		tags, err := s.expiryTags(op.Tags)
+		if err != nil {
+			return err
+		}
+
+		expiring[i].Tags = tags
+	}
+
+	return s.Store.Batch(expiring)
+}
+
+func (s *ttlStore) Get(key string) ([]byte, error) {
+	value, err := s.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	expired, err := s.expired(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if expired {
+		return nil, storage.ErrDataNotFound
+	}
+
+	return value, nil
+}
+
+func (s *ttlStore) GetBulk(keys ...string) ([][]byte, error) {
+	values, err := s.Store.GetBulk(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		expired, expiredErr := s.expired(keys[i])
+		if expiredErr != nil {
+			return nil, expiredErr
+		}
+
+		if expired {
+			values[i] = nil
+		}
+	}
+
+	return values, nil
+}
+
+// expiryTags replaces the TTLTag in tags, if any, with an expiry tag.
+func (s *ttlStore) expiryTags(tags []storage.Tag) ([]storage.Tag, error) {
+	ttl := s.ttl
+	result := make([]storage.Tag, 0, len(tags)+1)
+
+	for _, tag := range tags {
+		if tag.Name != ttlTagName {
+			result = append(result, tag)
+
+			continue
+		}
+
+		var err error
+
+		ttl, err = time.ParseDuration(tag.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl tag: %w", err)
+		}
+	}
+
+	if ttl <= 0 {
+		return result, nil
+	}
+
+	expiry := s.clock.Now().Add(ttl).UnixNano()
+
+	return append(result, storage.Tag{Name: ExpiryTagName, Value: strconv.FormatInt(expiry, 10)}), nil
+}
+
+// expired reports whether the value at key has expired, deleting it if so.
+func (s *ttlStore) expired(key string) (bool, error) {
+	tags, err := s.Store.GetTags(key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, tag := range tags {
+		if tag.Name != ExpiryTagName {
+			continue
+		}
+
+		expiry, parseErr := strconv.ParseInt(tag.Value, 10, 64)
+		if parseErr != nil {
+			return false, fmt.Errorf("invalid expiry tag on key %s: %w", truncateKey(key), parseErr)
+		}
+
+		if s.clock.Now().UnixNano() < expiry {
+			return false, nil
+		}
+
+		return true, s.Store.Delete(key)
+	}
+
+	return false, nil
+}
+
+type readAfterWriteStore struct {
+	storage.Store
+	window time.Duration
+	clock  Clock
+	mutex  sync.Mutex
+	writes map[string]time.Time
+}
+
+func (s *readAfterWriteStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if err := s.Store.Put(key, value, tags...); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+
+	// forget writes that are out of the window so that the map stays bounded
+	for k, written := range s.writes {
+		if now.Sub(written) >= s.window {
+			delete(s.writes, k)
+		}
+	}
+
+	s.writes[key] = now
+
+	return nil
+}
+
+func (s *readAfterWriteStore) Get(key string) ([]byte, error) {
+	for {
+		value, err := s.Store.Get(key)
+		if !IsNotFound(err) || !s.recentlyWritten(key) {
+			return value, err
+		}
+
+		<-s.clock.After(readAfterWriteInterval)
+	}
+}
+
+func (s *readAfterWriteStore) recentlyWritten(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	written, ok := s.writes[key]
+
+	return ok && s.clock.Now().Sub(written) < s.window
+}
+
+// flightCall is a Get in progress on a singleFlightStore, with dups callers waiting for its result.
+type flightCall struct {
+	done  chan struct{}
+	dups  int
+	value []byte
+	err   error
+}
+
+type singleFlightStore struct {
+	storage.Store
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (s *singleFlightStore) Get(key string) ([]byte, error) {
+	s.mutex.Lock()
+
+	if call, ok := s.calls[key]; ok {
+		call.dups++
+		s.mutex.Unlock()
+		<-call.done
+
+		// each waiter gets its own copy so that callers modifying the value don't affect each other
+		return append([]byte(nil), call.value...), call.err
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	s.calls[key] = call
+	s.mutex.Unlock()
+
+	returned := false
+
+	// the waiters are released even if the store panics, with an error, while the panic goes on to the caller
+	defer func() {
+		if !returned {
+			call.err = fmt.Errorf("get %s: storage panicked", key)
+		}
+
+		s.mutex.Lock()
+		delete(s.calls, key)
+		s.mutex.Unlock()
+
+		close(call.done)
+	}()
+
+	value, err := s.Store.Get(key)
+	returned = true
+
+	// the waiters copy from their own copy, as the caller owns value once it is returned
+	call.value, call.err = append([]byte(nil), value...), err
+
+	return value, err
+}
+
+func withEntryTag(tags []storage.Tag) []storage.Tag {
+	for _, tag := range tags {
+		if tag.Name == EntryTagName {
+			return tags
+		}
+	}
+
+	return append(append([]storage.Tag{}, tags...), EntryTag)
+}
+
+func concurrencyLimiter(ctx context.Context, n int) interceptor {
+	sem := make(chan struct{}, n)
+
+	return func(_, _, _ string, call func() error) error {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		defer func() { <-sem }()
+
+		return call()
+	}
+}
+
+// storeTimeoutRegistry is implemented by the providers built WithOperationTimeout, to which
+// OpenPrefixedStoreWithTimeout gives the timeout of a store.
+type storeTimeoutRegistry interface {
+	setStoreTimeout(name string, d time.Duration) bool
+}
+
+// storeTimeouts holds the operation timeouts of the stores that have their own. Its methods accept a nil receiver,
+// which has none.
+type storeTimeouts struct {
+	mutex   sync.RWMutex
+	enabled bool
+	byName  map[string]time.Duration
+}
+
+func (o *buildOptions) timeouts() *storeTimeouts {
+	if o.storeTimeouts == nil {
+		o.storeTimeouts = &storeTimeouts{byName: map[string]time.Duration{}}
+	}
+
+	return o.storeTimeouts
+}
+
+// enable records that the timeouts are applied by the operation timeout wrapper.
+func (t *storeTimeouts) enable() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.enabled = true
+}
+
+func (t *storeTimeouts) set(name string, d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.byName[name] = d
+}
+
+// setIfEnabled sets the timeout of name if the timeouts are applied, reporting whether it did.
+func (t *storeTimeouts) setIfEnabled(name string, d time.Duration) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.enabled {
+		return false
+	}
+
+	t.byName[name] = d
+
+	return true
+}
+
+// get returns the timeout of name, or fallback if it has none.
+func (t *storeTimeouts) get(name string, fallback time.Duration) time.Duration {
+	if t == nil {
+		return fallback
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if d, ok := t.byName[name]; ok {
+		return d
+	}
+
+	return fallback
+}
+
+// operationTimeout aborts the operations on each store after its timeout in timeouts, d for the stores without
+// one. timeouts may be nil.
+func operationTimeout(ctx context.Context, d time.Duration, timeouts *storeTimeouts) interceptor {
+	return func(op, storeName, _ string, call func() error) error {
+		timeout := timeouts.get(storeName, d)
+		if timeout <= 0 {
+			return call()
+		}
+
+		opCtx, cancel := ctx, context.CancelFunc(func() {})
+		if _, ok := ctx.Deadline(); !ok {
+			opCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		defer cancel()
+
+		result := make(chan error, 1)
+
+		go func() {
+			result <- call()
+		}()
+
+		select {
+		case err := <-result:
+			return err
+		case <-opCtx.Done():
+			return fmt.Errorf("%s on store %s aborted: %w", op, storeName, opCtx.Err())
+		}
+	}
+}
+
+func validateUTF8Key(op, storeName, key string, call func() error) error {
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("%w: %s on store %s: key %q is not valid UTF-8", ErrInvalidKey, op, storeName,
+			truncateKey(key))
+	}
+
+	return call()
+}
+
+func errorContext(op, storeName, key string, call func() error) error {
+	err := call()
+	if err == nil {
+		return nil
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s on store %s: %w", op, storeName, err)
+	}
+
+	return fmt.Errorf("%s on store %s with key %s: %w", op, storeName, truncateKey(key), err)
+}
+
+// loggedErrorContext annotates errors as errorContext does and logs them through logger with their fields.
+func loggedErrorContext(logger StructuredLogger, clock Clock) interceptor {
+	return func(op, storeName, key string, call func() error) error {
+		started := clock.Now()
+
+		err := errorContext(op, storeName, key, call)
+		if err == nil {
+			return nil
+		}
+
+		fields := map[string]interface{}{
+			"operation": op,
+			"store":     storeName,
+			"duration":  clock.Now().Sub(started),
+			"error":     err.Error(),
+		}
+
+		if key != "" {
+			fields["key"] = truncateKey(key)
+		}
+
+		logger.ErrorWithFields("store operation failed", fields)
+
+		return err
+	}
+}
+
+// truncateKey shortens key for use in error and log messages.
+func truncateKey(key string) string {
+	const maxKeyLength = 16
+
+	if len(key) <= maxKeyLength {
+		return key
+	}
+
+	return key[:maxKeyLength] + "..."
+}
+
+// interceptor runs a store operation on behalf of a wrapper. op is the store method name and key is empty
+// for operations that are not tied to a single key.
+type interceptor func(op, storeName, key string, call func() error) error
+
+type interceptedProvider struct {
+	storage.Provider
+	intercept interceptor
+}
+
+func interceptStores(p storage.Provider, intercept interceptor) storage.Provider {
+	return &interceptedProvider{Provider: p, intercept: intercept}
+}
+
+func (p *interceptedProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &interceptedStore{Store: store, name: name, intercept: p.intercept}, nil
+}
+
+type interceptedStore struct {
+	storage.Store
+	name      string
+	intercept interceptor
+}
+
+func (s *interceptedStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.intercept("Put", s.name, key, func() error {
+		return s.Store.Put(key, value, tags...)
+	})
+}
+
+func (s *interceptedStore) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := s.intercept("Get", s.name, key, func() error {
+		var err error
+		value, err = s.Store.Get(key)
+
+		return err
+	})
+	if err != nil {
+		// an interceptor may abandon the call, which then still writes its result
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (s *interceptedStore) GetTags(key string) ([]storage.Tag, error) {
+	var tags []storage.Tag
+
+	err := s.intercept("GetTags", s.name, key, func() error {
+		var err error
+		tags, err = s.Store.GetTags(key)
+
+		return err
+	})
+	if err != nil {
+		// an interceptor may abandon the call, which then still writes its result
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s *interceptedStore) GetBulk(keys ...string) ([][]byte, error) {
+	var values [][]byte
+
+	err := s.intercept("GetBulk", s.name, "", func() error {
+		var err error
+		values, err = s.Store.GetBulk(keys...)
+
+		return err
+	})
+	if err != nil {
+		// an interceptor may abandon the call, which then still writes its result
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s *interceptedStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	var iterator storage.Iterator
+
+	err := s.intercept("Query", s.name, "", func() error {
+		var err error
+		iterator, err = s.Store.Query(expression, options...)
+
+		return err
+	})
+	if err != nil {
+		// an interceptor may abandon the call, which then still writes its result
+		return nil, err
+	}
+
+	return iterator, nil
+}
+
+func (s *interceptedStore) Delete(key string) error {
+	return s.intercept("Delete", s.name, key, func() error {
+		return s.Store.Delete(key)
+	})
+}
+
+func (s *interceptedStore) Batch(operations []storage.Operation) error {
+	return s.intercept("Batch", s.name, "", func() error {
+		return s.Store.Batch(operations)
+	})
+}
+
+func (s *interceptedStore) Flush() error {
+	return s.intercept("Flush", s.name, "", s.Store.Flush)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// ErrRateLimited is returned without calling the store by providers built WithRateLimit and WithRateLimitFailFast
+// when the rate is exceeded.
+var ErrRateLimited = errors.New("storage rate limit exceeded")
+
+// WithRateLimit throttles the store operations of the provider, all stores together, to rps per second on
+// average with bursts of up to burst operations, as a token bucket refilled on the clock given with WithClock.
+// Operations over the rate wait for their turn, or until the provider context is done, unless
+// WithRateLimitFailFast is given. A rate of zero or less disables the limiter; the burst is at least 1.
+func WithRateLimit(rps float64, burst int) BuildOption {
+	return func(opts *buildOptions) {
+		if rps <= 0 {
+			return
+		}
+
+		if burst < 1 {
+			burst = 1
+		}
+
+		opts.wrappers = append(opts.wrappers, func(p storage.Provider) storage.Provider {
+			limiter := &rateLimiter{
+				ctx: opts.ctx, clock: opts.clock, rps: rps, burst: float64(burst), failFast: opts.rateLimitFailFast,
+				tokens: float64(burst), last: opts.clock.Now(),
+			}
+
+			return interceptStores(p, limiter.intercept)
+		})
+	}
+}
+
+// WithRateLimitFailFast makes the operations over the rate of WithRateLimit fail with ErrRateLimited instead of
+// waiting.
+func WithRateLimitFailFast() BuildOption {
+	return func(opts *buildOptions) {
+		opts.rateLimitFailFast = true
+	}
+}
+
+type rateLimiter struct {
+	ctx      context.Context
+	clock    Clock
+	rps      float64
+	burst    float64
+	failFast bool
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) intercept(op, storeName, _ string, call func() error) error {
+	wait, ok := l.reserve()
+	if !ok {
+		return fmt.Errorf("%w: %s on store %s", ErrRateLimited, op, storeName)
+	}
+
+	if wait > 0 {
+		select {
+		case <-l.clock.After(wait):
+		case <-l.ctx.Done():
+			l.cancel()
+
+			return l.ctx.Err()
+		}
+	}
+
+	return call()
+}
+
+// reserve takes a token, returning how long to wait for it to be available. In fail fast mode, a token is only
+// taken if it is available right away; otherwise false is returned.
+func (l *rateLimiter) reserve() (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.clock.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+
+	if l.failFast && l.tokens < 1 {
+		return 0, false
+	}
+
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0, true
+	}
+
+	return time.Duration(math.Ceil(-l.tokens / l.rps * float64(time.Second))), true
+}
+
+// cancel returns the token of a reservation that was not used.
+func (l *rateLimiter) cancel() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.tokens++
+}
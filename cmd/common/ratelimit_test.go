@@ -0,0 +1,88 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	open := func(t *testing.T, clock Clock, opts ...BuildOption) storage.Store {
+		t.Helper()
+
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, append([]BuildOption{WithClock(clock)},
+			opts...)...)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("limited")
+		require.NoError(t, err)
+
+		return s
+	}
+
+	t.Run("waits for the rate", func(t *testing.T) {
+		clock := newFakeClock()
+		s := open(t, clock, WithRateLimit(10, 2))
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, s.Put("key", []byte("value")))
+		}
+
+		require.Equal(t, time.Duration(0), clock.Now().Sub(clock.start), "the burst must not wait")
+
+		for i := 0; i < 3; i++ {
+			_, err := s.Get("key")
+			require.NoError(t, err)
+		}
+
+		require.InDelta(t, float64(300*time.Millisecond), float64(clock.Now().Sub(clock.start)),
+			float64(time.Millisecond))
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		clock := newFakeClock()
+		s := open(t, clock, WithRateLimitFailFast(), WithRateLimit(1, 1))
+
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		_, err := s.Get("key")
+		require.True(t, errors.Is(err, ErrRateLimited))
+		require.Contains(t, err.Error(), "Get on store limited")
+
+		<-clock.After(time.Second)
+
+		_, err = s.Get("key")
+		require.NoError(t, err)
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		s := open(t, &manualClock{ticks: make(chan time.Time)}, WithContext(ctx), WithRateLimit(1, 1))
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.True(t, errors.Is(s.Put("key", []byte("value")), context.Canceled))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		clock := newFakeClock()
+		s := open(t, clock, WithRateLimit(0, 1))
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, s.Put("key", []byte("value")))
+		}
+
+		require.Equal(t, time.Duration(0), clock.Now().Sub(clock.start))
+	})
+}
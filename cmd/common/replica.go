@@ -0,0 +1,146 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// WithReadReplica connects BuildProvider to the read replica at replicaURL, in the format of DBParameters.URL,
+// besides the primary. Stores opened through the provider then read from the replica and write to the primary.
+// An empty URL, or one equivalent to that of the primary as told by CanonicalizeURL, uses the primary for
+// everything. BuildProvider applies DBParameters.ReplicaURL with this option.
+func WithReadReplica(replicaURL string) BuildOption {
+	return func(opts *buildOptions) {
+		opts.replicaURL = replicaURL
+	}
+}
+
+// connectPrimaryAndReplica connects as connectReplicated does, counting the connection in the lifecycle metrics
+// of options.
+func connectPrimaryAndReplica(params *DBParameters, logger log.Logger,
+	options *buildOptions) (storage.Provider, error) {
+	provider, err := connectReplicated(params, logger, options)
+	options.lifecycle.observeConnect(err)
+
+	return provider, err
+}
+
+// connectReplicated connects to the primary storage of params and, if options has a replica URL, to the
+// replica, returning a provider that routes between them.
+func connectReplicated(params *DBParameters, logger log.Logger, options *buildOptions) (storage.Provider, error) {
+	primary, err := connect(params, logger, options.clock, options.rand, options.connectHooks())
+	if err != nil {
+		return nil, err
+	}
+
+	if options.replicaURL == "" || sameURL(options.replicaURL, params.URL) {
+		return primary.Provider, nil
+	}
+
+	replicaParams := params.Clone()
+	replicaParams.URL = options.replicaURL
+	replicaParams.ReplicaURL = ""
+
+	replica, err := connect(replicaParams, logger, options.clock, options.rand, options.connectHooks())
+	if err != nil {
+		_ = primary.Provider.Close() // nolint:errcheck
+
+		return nil, fmt.Errorf("connect to read replica: %w", err)
+	}
+
+	return &replicatedProvider{Provider: primary.Provider, replica: replica.Provider}, nil
+}
+
+// sameURL reports whether a and b are equivalent database URLs, as told by CanonicalizeURL. URLs that cannot be
+// canonicalized are the same only if they are equal.
+func sameURL(a, b string) bool {
+	canonicalA, errA := CanonicalizeURL(a)
+	canonicalB, errB := CanonicalizeURL(b)
+
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	return canonicalA == canonicalB
+}
+
+// replicatedProvider opens every store on both the primary, which it embeds, and the replica. Store
+// configuration and GetOpenStores are those of the primary.
+type replicatedProvider struct {
+	storage.Provider
+	replica storage.Provider
+}
+
+func (p *replicatedProvider) OpenStore(name string) (storage.Store, error) {
+	primary, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	replica, err := p.replica.OpenStore(name)
+	if err != nil {
+		err = fmt.Errorf("open replica store %s: %w", name, err)
+
+		if closeErr := primary.Close(); closeErr != nil {
+			return nil, multiError{err, fmt.Errorf("close store %s: %w", name, closeErr)}
+		}
+
+		return nil, err
+	}
+
+	return &replicatedStore{Store: primary, replica: replica}, nil
+}
+
+func (p *replicatedProvider) Close() error {
+	var errs multiError
+
+	for _, provider := range []storage.Provider{p.Provider, p.replica} {
+		if err := provider.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
+
+// replicatedStore writes to the primary store, which it embeds, and reads from the replica.
+type replicatedStore struct {
+	storage.Store
+	replica storage.Store
+}
+
+func (s *replicatedStore) Get(key string) ([]byte, error) {
+	return s.replica.Get(key)
+}
+
+func (s *replicatedStore) GetTags(key string) ([]storage.Tag, error) {
+	return s.replica.GetTags(key)
+}
+
+func (s *replicatedStore) GetBulk(keys ...string) ([][]byte, error) {
+	return s.replica.GetBulk(keys...)
+}
+
+func (s *replicatedStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	return s.replica.Query(expression, options...)
+}
+
+func (s *replicatedStore) Close() error {
+	var errs multiError
+
+	for _, store := range []storage.Store{s.Store, s.replica} {
+		if err := store.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
@@ -0,0 +1,121 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadReplica(t *testing.T) {
+	newRecordingProvider := func(scheme string) *[]string {
+		calls := &[]string{}
+
+		registerTestDriver(t, scheme, interceptStores(mem.NewProvider(),
+			func(op, _, _ string, call func() error) error {
+				*calls = append(*calls, op)
+
+				return call()
+			}))
+
+		return calls
+	}
+
+	t.Run("read from env", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+		require.NoError(t, os.Setenv(DatabaseReplicaURLEnvKey, "mem://replica"))
+		cmd := &cobra.Command{}
+		Flags(cmd)
+		result, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, "mem://replica", result.ReplicaURL)
+	})
+
+	t.Run("reads go to the replica and writes to the primary", func(t *testing.T) {
+		primary := newRecordingProvider("primary")
+		replica := newRecordingProvider("replica")
+
+		p, err := BuildProvider(&DBParameters{URL: "primary://test", ReplicaURL: "replica://test"}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("reports")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("a", []byte("1")))
+		require.NoError(t, s.Batch([]storage.Operation{{Key: "b", Value: []byte("2")}}))
+		require.NoError(t, s.Delete("a"))
+
+		_, err = s.Get("a")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+		_, err = s.GetBulk("b")
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"Put", "Batch", "Delete"}, *primary)
+		require.Equal(t, []string{"Get", "GetBulk"}, *replica)
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("unset replica uses the primary", func(t *testing.T) {
+		primary := newRecordingProvider("primary")
+
+		p, err := BuildProvider(&DBParameters{URL: "primary://test"}, logger)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("reports")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("a", []byte("1")))
+		_, err = s.Get("a")
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"Put", "Get"}, *primary)
+	})
+
+	t.Run("replica store fails to open", func(t *testing.T) {
+		primary := &closingStore{}
+		p := &replicatedProvider{
+			Provider: &mockProvider{store: primary},
+			replica:  &mockProvider{openErr: errors.New("no such database")},
+		}
+
+		s, err := p.OpenStore("reports")
+		require.EqualError(t, err, "open replica store reports: no such database")
+		require.Nil(t, s)
+		require.True(t, primary.closed)
+
+		primary.closeErr = errors.New("connection reset")
+
+		_, err = p.OpenStore("reports")
+		require.EqualError(t, err,
+			"open replica store reports: no such database; close store reports: connection reset")
+	})
+
+	t.Run("replica connection fails", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test", ReplicaURL: "redis://replica", Timeout: 1}, logger)
+		require.EqualError(t, err, "connect to read replica: unsupported storage driver: redis")
+		require.Nil(t, p)
+	})
+}
+
+type closingStore struct {
+	storage.Store
+	closed   bool
+	closeErr error
+}
+
+func (s *closingStore) Close() error {
+	s.closed = true
+
+	return s.closeErr
+}
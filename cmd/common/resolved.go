@@ -0,0 +1,141 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ResolvedDBConfig is the database configuration of a command as DBParams resolves it, for reporting through
+// admin APIs. The passwords of the URLs are masked and inline CA certificates are not included.
+type ResolvedDBConfig struct {
+	// DriverScheme is the storage driver selected by the URL scheme or DATABASE_DRIVER.
+	DriverScheme     string   `json:"driver_scheme"`
+	MaskedURL        string   `json:"masked_url"`
+	MaskedReplicaURL string   `json:"masked_replica_url,omitempty"`
+	Database         string   `json:"database,omitempty"`
+	Prefix           string   `json:"prefix"`
+	StoreName        string   `json:"store_name"`
+	Timeout          uint64   `json:"timeout"`
+	TotalTimeout     uint64   `json:"total_timeout,omitempty"`
+	RetryJitter      bool     `json:"retry_jitter"`
+	RetryMinBackoff  string   `json:"retry_min_backoff,omitempty"`
+	RetryMaxBackoff  string   `json:"retry_max_backoff,omitempty"`
+	RetryStatusCodes []int    `json:"retry_status_codes,omitempty"`
+	MaxValueSize     int      `json:"max_value_size,omitempty"`
+	MaxStores        int      `json:"max_stores,omitempty"`
+	AllowClear       bool     `json:"allow_clear"`
+	CompatMode       string   `json:"compat_mode,omitempty"`
+	AppName          string   `json:"app_name,omitempty"`
+	ConnMaxLifetime  string   `json:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime  string   `json:"conn_max_idle_time,omitempty"`
+	CloseTimeout     string   `json:"close_timeout,omitempty"`
+	TLSCACerts       []string `json:"tls_ca_certs,omitempty"`
+}
+
+// inlineCertPlaceholder replaces inline PEM content in ResolvedDBConfig.TLSCACerts.
+const inlineCertPlaceholder = "<inline certificate>"
+
+// ResolvedConfig returns the database configuration of cmd as DBParams resolves it, failing as DBParams does
+// and with an ErrCodeInvalidURL error if no driver can be told from the URL.
+func ResolvedConfig(cmd *cobra.Command) (*ResolvedDBConfig, error) {
+	params, err := DBParams(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := strings.ToLower(params.Driver)
+	if driver == "" {
+		driver, _, err = parseDBURL(params.URL)
+		if err != nil {
+			return nil, withCode(ErrCodeInvalidURL, err)
+		}
+	}
+
+	config := &ResolvedDBConfig{
+		DriverScheme:     driver,
+		MaskedURL:        maskURL(params.URL),
+		MaskedReplicaURL: maskURL(params.ReplicaURL),
+		Database:         params.Name,
+		Prefix:           params.Prefix,
+		StoreName:        params.StoreName,
+		Timeout:          params.Timeout,
+		TotalTimeout:     params.TotalTimeout,
+		RetryJitter:      params.RetryJitter,
+		RetryMinBackoff:  durationString(params.RetryMinBackoff),
+		RetryMaxBackoff:  durationString(params.RetryMaxBackoff),
+		RetryStatusCodes: params.RetryStatusCodes,
+		MaxValueSize:     params.MaxValueSize,
+		MaxStores:        params.MaxStores,
+		AllowClear:       params.AllowClear,
+		CompatMode:       params.CompatMode,
+		AppName:          params.AppName,
+		ConnMaxLifetime:  durationString(params.ConnMaxLifetime),
+		ConnMaxIdleTime:  durationString(params.ConnMaxIdleTime),
+		CloseTimeout:     durationString(params.CloseTimeout),
+	}
+
+	for _, entry := range params.TLSCACerts {
+		if strings.Contains(entry, pemMarker) {
+			entry = inlineCertPlaceholder
+		}
+
+		config.TLSCACerts = append(config.TLSCACerts, entry)
+	}
+
+	return config, nil
+}
+
+// durationString formats d for ResolvedDBConfig, as "" when it is not set.
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+// ConfigFingerprint returns a hex SHA-256 hash of the settings of params that select the storage and the data in
+// it: the driver, the URLs without their passwords, the database name, the prefix and its position, and the
+// timeouts. Equivalent URLs, as told by CanonicalizeURL, give the same fingerprint, so it changes only when the
+// effective configuration does, and not with the credentials, for change detection and audit logs.
+func ConfigFingerprint(params *DBParameters) string {
+	fields := []string{
+		"driver=" + driverName(params),
+		"url=" + fingerprintURL(params.URL),
+		"replica_url=" + fingerprintURL(params.ReplicaURL),
+		"database=" + params.Name,
+		"prefix=" + params.Prefix,
+		"prefix_position=" + params.PrefixPosition,
+		fmt.Sprintf("timeout=%d", params.Timeout),
+		fmt.Sprintf("total_timeout=%d", params.TotalTimeout),
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprintURL returns the canonical form of dbURL, or dbURL if it has none, without its password.
+func fingerprintURL(dbURL string) string {
+	if canonical, err := CanonicalizeURL(dbURL); err == nil {
+		dbURL = canonical
+	}
+
+	prefix, user, _, rest, ok := splitUserInfo(dbURL)
+	if !ok {
+		return dbURL
+	}
+
+	return prefix + user + rest
+}
@@ -0,0 +1,302 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/trustbloc/edge-core/pkg/log"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+)
+
+// retryInterval is the wait between two connection attempts, or its upper bound when jitter is enabled.
+const retryInterval = time.Second
+
+// minStatusCode and maxStatusCode bound the HTTP status codes accepted by DatabaseRetryStatusCodesEnvKey.
+const (
+	minStatusCode = 100
+	maxStatusCode = 599
+)
+
+// newRetryRand returns the random source used for the retry jitter when none is given with WithRandSource.
+func newRetryRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano())) // nolint:gosec
+}
+
+func readDBRetryStatusCodes(cmd *cobra.Command, params *DBParameters) error {
+	value := cmdutils.GetUserSetOptionalVarFromString(cmd, DatabaseRetryStatusCodesFlagName,
+		DatabaseRetryStatusCodesEnvKey)
+
+	params.RetryStatusCodes = nil
+
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < minStatusCode || code > maxStatusCode {
+			return fmt.Errorf("failed to configure dbRetryStatusCodes: invalid HTTP status code %s", entry)
+		}
+
+		params.RetryStatusCodes = append(params.RetryStatusCodes, code)
+	}
+
+	return nil
+}
+
+// permanentStatus marks err permanent, which stops the retries, if it carries an HTTP status code that is not
+// transient for params: one of params.RetryStatusCodes or, if none is set, a 5xx code or 429. Errors without a
+// status code are returned as is.
+func permanentStatus(params *DBParameters, err error) error {
+	var coder statusCoder
+	if err == nil || !errors.As(err, &coder) {
+		return err
+	}
+
+	code := coder.StatusCode()
+	transient := code == http.StatusTooManyRequests || code >= http.StatusInternalServerError && code <= maxStatusCode
+
+	if len(params.RetryStatusCodes) > 0 {
+		transient = false
+
+		for _, retried := range params.RetryStatusCodes {
+			transient = transient || code == retried
+		}
+	}
+
+	if transient {
+		return err
+	}
+
+	return backoff.Permanent(err)
+}
+
+// retryBackOff returns the schedule of the connection attempts: each after retryInterval, or after a random
+// wait of up to retryInterval if params.RetryJitter is set. With params.RetryMinBackoff or params.RetryMaxBackoff,
+// the wait instead doubles after each attempt and, jitter included, stays within those bounds. Retries stop once
+// the next one would start past the deadline, if one is given, and otherwise there are up to params.Timeout
+// retries, 30 by default, about as many seconds with the fixed waits. With the doubling waits, the retries instead
+// stop once the next one would start more than params.Timeout seconds from now.
+func retryBackOff(params *DBParameters, rng *rand.Rand, clock Clock, deadline time.Time) backoff.BackOff {
+	var b backoff.BackOff = backoff.NewConstantBackOff(retryInterval)
+
+	bounded := params.RetryMinBackoff > 0 || params.RetryMaxBackoff > 0
+	if bounded {
+		b = exponentialBackOff(params, clock)
+	}
+
+	if params.RetryJitter {
+		b = &jitterBackOff{BackOff: b, rand: rng}
+	}
+
+	if bounded {
+		b = &boundedBackOff{BackOff: b, min: params.RetryMinBackoff}
+	}
+
+	if !deadline.IsZero() {
+		return &deadlineBackOff{BackOff: b, clock: clock, deadline: deadline}
+	}
+
+	timeout := uint64(DatabaseTimeoutDefault)
+
+	if params.Timeout > 0 {
+		timeout = params.Timeout
+	}
+
+	if bounded {
+		return &deadlineBackOff{
+			BackOff: b, clock: clock, deadline: clock.Now().Add(time.Duration(timeout) * time.Second),
+		}
+	}
+
+	return backoff.WithMaxRetries(b, timeout)
+}
+
+// connectDeadline returns the time by which connecting must be done, or the zero time if params.TotalTimeout
+// is not set.
+func connectDeadline(params *DBParameters, clock Clock) time.Time {
+	if params.TotalTimeout == 0 {
+		return time.Time{}
+	}
+
+	return clock.Now().Add(time.Duration(params.TotalTimeout) * time.Second)
+}
+
+// openAttempt makes one connection attempt. When a deadline is set, the attempt is abandoned after
+// params.Timeout seconds or at the deadline, whichever comes first.
+func openAttempt(driver *resolvedDriver, params *DBParameters, clock Clock,
+	deadline time.Time) (storage.Provider, error) {
+	if deadline.IsZero() {
+		return openProvider(driver.factory, driver.dsn, params)
+	}
+
+	timeout := deadline.Sub(clock.Now())
+	if params.Timeout > 0 && time.Duration(params.Timeout)*time.Second < timeout {
+		timeout = time.Duration(params.Timeout) * time.Second
+	}
+
+	type attempt struct {
+		provider storage.Provider
+		err      error
+	}
+
+	done := make(chan attempt, 1)
+
+	go func() {
+		p, err := openProvider(driver.factory, driver.dsn, params)
+		done <- attempt{provider: p, err: err}
+	}()
+
+	select {
+	case a := <-done:
+		return a.provider, a.err
+	case <-clock.After(timeout):
+		go func() {
+			if a := <-done; a.provider != nil {
+				a.provider.Close() // nolint:errcheck
+			}
+		}()
+
+		return nil, fmt.Errorf("connection attempt timed out after %s", timeout)
+	}
+}
+
+// exponentialBackOff doubles the wait after each attempt, from params.RetryMinBackoff, or retryInterval, up to
+// params.RetryMaxBackoff, or backoff.DefaultMaxInterval. It never stops on its own: retryBackOff bounds it by
+// time.
+func exponentialBackOff(params *DBParameters, clock Clock) backoff.BackOff {
+	const multiplier = 2
+
+	maxInterval := params.RetryMaxBackoff
+	if maxInterval == 0 {
+		maxInterval = backoff.DefaultMaxInterval
+	}
+
+	initial := params.RetryMinBackoff
+	if initial == 0 {
+		initial = retryInterval
+	}
+
+	if initial > maxInterval {
+		initial = maxInterval
+	}
+
+	b := &backoff.ExponentialBackOff{
+		InitialInterval: initial,
+		Multiplier:      multiplier,
+		MaxInterval:     maxInterval,
+		Clock:           clock,
+	}
+	b.Reset()
+
+	return b
+}
+
+// boundedBackOff raises the waits of the wrapped backoff to min, as jitter may shorten them.
+type boundedBackOff struct {
+	backoff.BackOff
+	min time.Duration
+}
+
+func (b *boundedBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d == backoff.Stop || d >= b.min {
+		return d
+	}
+
+	return b.min
+}
+
+// deadlineBackOff stops the wrapped backoff once its next wait would end past the deadline.
+type deadlineBackOff struct {
+	backoff.BackOff
+	clock    Clock
+	deadline time.Time
+}
+
+func (b *deadlineBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d == backoff.Stop || b.clock.Now().Add(d).After(b.deadline) {
+		return backoff.Stop
+	}
+
+	return d
+}
+
+// jitterBackOff applies full jitter to the waits of the wrapped backoff, picking each uniformly between zero
+// and the original wait.
+type jitterBackOff struct {
+	backoff.BackOff
+	rand *rand.Rand
+}
+
+func (b *jitterBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d == backoff.Stop || d <= 0 {
+		return d
+	}
+
+	return time.Duration(b.rand.Int63n(int64(d) + 1))
+}
+
+// clockTimer is a backoff.Timer that waits on a Clock.
+type clockTimer struct {
+	clock Clock
+	c     <-chan time.Time
+}
+
+func (t *clockTimer) Start(d time.Duration) {
+	t.c = t.clock.After(d)
+}
+
+func (t *clockTimer) Stop() {}
+
+func (t *clockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// WaitForStore connects to the storage configured in params as InitEdgeStore does, starting over every poll
+// after a failed connection until one succeeds or ctx is done, which also stops the retries of a connection. It
+// is meant for tests racing the readiness of a storage container. A URL selecting no supported driver fails at
+// once.
+func WaitForStore(ctx context.Context, params *DBParameters, logger log.Logger,
+	poll time.Duration) (storage.Provider, error) {
+	return waitForStore(ctx, params, logger, poll, systemClock{})
+}
+
+func waitForStore(ctx context.Context, params *DBParameters, logger log.Logger, poll time.Duration,
+	clock Clock) (storage.Provider, error) {
+	if _, err := resolveDriver(params); err != nil {
+		return nil, err
+	}
+
+	rng := newRetryRand()
+
+	for {
+		result, err := connect(params, logger, clock, rng, connectHooks{ctx: ctx})
+		if err == nil {
+			return result.Provider, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for storage: %w, last error: %s", ctx.Err(), err)
+		case <-clock.After(poll):
+		}
+	}
+}
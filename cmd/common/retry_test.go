@@ -0,0 +1,414 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackOff(t *testing.T) {
+	schedule := func(b backoff.BackOff) []time.Duration {
+		var waits []time.Duration
+
+		for d := b.NextBackOff(); d != backoff.Stop; d = b.NextBackOff() {
+			waits = append(waits, d)
+		}
+
+		return waits
+	}
+
+	t.Run("deterministic without jitter", func(t *testing.T) {
+		waits := schedule(retryBackOff(&DBParameters{Timeout: 3}, rand.New(rand.NewSource(1)), systemClock{}, time.Time{}))
+		require.Equal(t, []time.Duration{retryInterval, retryInterval, retryInterval}, waits)
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		params := &DBParameters{Timeout: 50, RetryJitter: true}
+
+		waits := schedule(retryBackOff(params, rand.New(rand.NewSource(1)), systemClock{}, time.Time{}))
+		require.Len(t, waits, 50)
+
+		distinct := map[time.Duration]bool{}
+
+		for _, d := range waits {
+			require.GreaterOrEqual(t, int64(d), int64(0))
+			require.LessOrEqual(t, int64(d), int64(retryInterval))
+
+			distinct[d] = true
+		}
+
+		require.Greater(t, len(distinct), 1)
+
+		require.Equal(t, waits, schedule(retryBackOff(params, rand.New(rand.NewSource(1)), systemClock{}, time.Time{})))
+		require.NotEqual(t, waits, schedule(retryBackOff(params, rand.New(rand.NewSource(2)), systemClock{}, time.Time{})))
+	})
+
+	// timedSchedule lists the waits of the backoff for params, waiting each on a fake clock, and the time they
+	// took in total.
+	timedSchedule := func(params *DBParameters) ([]time.Duration, time.Duration) {
+		clock := newFakeClock()
+		b := retryBackOff(params, rand.New(rand.NewSource(1)), clock, time.Time{})
+
+		var waits []time.Duration
+
+		for d := b.NextBackOff(); d != backoff.Stop; d = b.NextBackOff() {
+			waits = append(waits, d)
+			<-clock.After(d)
+		}
+
+		return waits, clock.elapsed()
+	}
+
+	t.Run("exponential within the backoff bounds", func(t *testing.T) {
+		params := &DBParameters{Timeout: 6, RetryMinBackoff: 100 * time.Millisecond, RetryMaxBackoff: time.Second}
+
+		waits, _ := timedSchedule(params)
+		require.Equal(t, []time.Duration{
+			100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond,
+			time.Second, time.Second, time.Second, time.Second,
+		}, waits)
+
+		waits, _ = timedSchedule(&DBParameters{Timeout: 2, RetryMaxBackoff: 300 * time.Millisecond})
+		require.Len(t, waits, 6)
+
+		for _, d := range waits {
+			require.Equal(t, 300*time.Millisecond, d)
+		}
+
+		waits, _ = timedSchedule(&DBParameters{Timeout: 7, RetryMinBackoff: 2 * time.Second})
+		require.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second}, waits)
+	})
+
+	t.Run("exponential bounded by the timeout in seconds", func(t *testing.T) {
+		for _, params := range []*DBParameters{
+			{Timeout: 30, RetryMinBackoff: 100 * time.Millisecond, RetryMaxBackoff: 10 * time.Second},
+			{Timeout: 3, RetryMinBackoff: 10 * time.Millisecond, RetryMaxBackoff: 10 * time.Millisecond},
+			{Timeout: 1, RetryMinBackoff: 2 * time.Second},
+			{RetryMaxBackoff: time.Second},
+		} {
+			timeout := time.Duration(params.Timeout) * time.Second
+			if params.Timeout == 0 {
+				timeout = DatabaseTimeoutDefault * time.Second
+			}
+
+			waits, elapsed := timedSchedule(params)
+			require.LessOrEqual(t, int64(elapsed), int64(timeout))
+
+			if len(waits) > 0 {
+				require.Greater(t, int64(elapsed+waits[len(waits)-1]), int64(timeout))
+			}
+		}
+
+		waits, _ := timedSchedule(&DBParameters{Timeout: 3, RetryMinBackoff: 10 * time.Millisecond,
+			RetryMaxBackoff: 10 * time.Millisecond})
+		require.Len(t, waits, 300)
+	})
+
+	t.Run("jitter stays within the backoff bounds", func(t *testing.T) {
+		params := &DBParameters{
+			Timeout: 50, RetryJitter: true, RetryMinBackoff: 100 * time.Millisecond, RetryMaxBackoff: time.Second,
+		}
+
+		waits, elapsed := timedSchedule(params)
+		require.Greater(t, len(waits), 50)
+		require.LessOrEqual(t, int64(elapsed), int64(50*time.Second))
+
+		for _, d := range waits {
+			require.GreaterOrEqual(t, int64(d), int64(params.RetryMinBackoff))
+			require.LessOrEqual(t, int64(d), int64(params.RetryMaxBackoff))
+		}
+	})
+
+	t.Run("connection retries back off on the clock", func(t *testing.T) {
+		attempts := 0
+
+		registerTestFactory(t, "flaky", func(string, *DBParameters) (storage.Provider, error) {
+			attempts++
+			if attempts <= 4 {
+				return nil, errors.New("not ready")
+			}
+
+			return mem.NewProvider(), nil
+		})
+
+		clock := newFakeClock()
+
+		_, err := BuildProvider(&DBParameters{
+			URL: "flaky://", Timeout: 10, RetryMinBackoff: time.Second, RetryMaxBackoff: 3 * time.Second,
+		}, logger, WithClock(clock))
+		require.NoError(t, err)
+		require.Equal(t, 5, attempts)
+		require.Equal(t, (1+2+3+3)*time.Second, clock.elapsed())
+
+		attempts = 0
+		clock = newFakeClock()
+
+		_, err = BuildProvider(&DBParameters{
+			URL: "flaky://", Timeout: 5, RetryMinBackoff: time.Second, RetryMaxBackoff: 3 * time.Second,
+		}, logger, WithClock(clock))
+		require.Error(t, err)
+		require.Equal(t, 3, attempts)
+		require.Equal(t, (1+2)*time.Second, clock.elapsed())
+	})
+
+	t.Run("connection retries wait on the clock", func(t *testing.T) {
+		for _, jitter := range []bool{false, true} {
+			attempts := 0
+
+			registerTestFactory(t, "flaky", func(string, *DBParameters) (storage.Provider, error) {
+				attempts++
+				if attempts <= 3 {
+					return nil, errors.New("not ready")
+				}
+
+				return mem.NewProvider(), nil
+			})
+
+			clock := newFakeClock()
+
+			_, err := BuildProvider(&DBParameters{URL: "flaky://", Timeout: 5, RetryJitter: jitter}, logger,
+				WithClock(clock), WithRandSource(rand.NewSource(1)))
+			require.NoError(t, err)
+			require.Equal(t, 4, attempts)
+
+			if jitter {
+				require.Less(t, int64(clock.elapsed()), int64(3*retryInterval))
+			} else {
+				require.Equal(t, 3*retryInterval, clock.elapsed())
+			}
+		}
+	})
+}
+
+func TestRetryBackoffBounds(t *testing.T) {
+	defer unsetEnv(t)
+
+	setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+	require.NoError(t, os.Setenv(DatabaseRetryMinBackoffEnvKey, "250ms"))
+	require.NoError(t, os.Setenv(DatabaseRetryMaxBackoffEnvKey, "10s"))
+
+	cmd := &cobra.Command{}
+	Flags(cmd)
+
+	params, err := DBParams(cmd)
+	require.NoError(t, err)
+	require.Equal(t, 250*time.Millisecond, params.RetryMinBackoff)
+	require.Equal(t, 10*time.Second, params.RetryMaxBackoff)
+
+	require.NoError(t, os.Setenv(DatabaseRetryMinBackoffEnvKey, "1m"))
+
+	_, err = DBParams(cmd)
+	require.EqualError(t, err, "failed to configure dbRetryMaxBackoff: 10s is shorter than the minimum backoff 1m0s")
+	require.Equal(t, ErrCodeInvalidTimeout, ErrorCode(err))
+
+	require.NoError(t, os.Setenv(DatabaseRetryMinBackoffEnvKey, "soon"))
+
+	_, err = DBParams(cmd)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to configure dbRetryMinBackoff")
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	connectWith := func(t *testing.T, status int, params *DBParameters) int {
+		t.Helper()
+
+		attempts := 0
+
+		registerTestFactory(t, "fakecouch", func(string, *DBParameters) (storage.Provider, error) {
+			attempts++
+
+			return nil, fmt.Errorf("connect: %w", &httpStatusError{status: status})
+		})
+
+		params.URL, params.Timeout = "fakecouch://localhost", 2
+
+		_, err := BuildProvider(params, logger, WithClock(newFakeClock()))
+		require.Error(t, err)
+
+		return attempts
+	}
+
+	t.Run("defaults retry 5xx and 429", func(t *testing.T) {
+		require.Equal(t, 3, connectWith(t, http.StatusServiceUnavailable, &DBParameters{}))
+		require.Equal(t, 3, connectWith(t, http.StatusTooManyRequests, &DBParameters{}))
+		require.Equal(t, 1, connectWith(t, http.StatusUnauthorized, &DBParameters{}))
+	})
+
+	t.Run("configured codes", func(t *testing.T) {
+		params := func() *DBParameters {
+			return &DBParameters{RetryStatusCodes: []int{http.StatusBadGateway, http.StatusConflict}}
+		}
+
+		require.Equal(t, 3, connectWith(t, http.StatusBadGateway, params()))
+		require.Equal(t, 3, connectWith(t, http.StatusConflict, params()))
+		require.Equal(t, 1, connectWith(t, http.StatusServiceUnavailable, params()))
+	})
+
+	t.Run("errors without status are retried", func(t *testing.T) {
+		require.EqualError(t, permanentStatus(&DBParameters{}, errors.New("refused")), "refused")
+		require.NoError(t, permanentStatus(&DBParameters{}, nil))
+	})
+
+	t.Run("read from env", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		require.NoError(t, os.Setenv(DatabaseRetryStatusCodesEnvKey, "502, 503"))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, []int{502, 503}, params.RetryStatusCodes)
+
+		require.NoError(t, os.Setenv(DatabaseRetryStatusCodesEnvKey, "502,5xx"))
+
+		_, err = DBParams(cmd)
+		require.EqualError(t, err, "failed to configure dbRetryStatusCodes: invalid HTTP status code 5xx")
+	})
+}
+
+func TestTotalTimeout(t *testing.T) {
+	// hangingFactory never returns until the test ends, so that every attempt runs into its timeout.
+	// The attempts run in their own goroutines, so the count is read with attemptsMade.
+	hangingFactory := func(t *testing.T) *int32 {
+		t.Helper()
+
+		release := make(chan struct{})
+		t.Cleanup(func() { close(release) })
+
+		var attempts int32
+
+		registerTestFactory(t, "hanging", func(string, *DBParameters) (storage.Provider, error) {
+			atomic.AddInt32(&attempts, 1)
+			<-release
+
+			return nil, errors.New("released")
+		})
+
+		return &attempts
+	}
+
+	t.Run("attempt is abandoned at the per-attempt timeout", func(t *testing.T) {
+		attempts := hangingFactory(t)
+		clock := newFakeClock()
+
+		_, err := BuildProvider(&DBParameters{URL: "hanging://", Timeout: 2, TotalTimeout: 2}, logger,
+			WithClock(clock))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "connection attempt timed out after 2s")
+		require.True(t, errors.Is(err, ErrConnectTimeout))
+		attemptsMade(t, attempts, 1)
+		require.Equal(t, 2*time.Second, clock.elapsed())
+	})
+
+	t.Run("loop stops at the total budget", func(t *testing.T) {
+		attempts := hangingFactory(t)
+		clock := newFakeClock()
+
+		_, err := BuildProvider(&DBParameters{URL: "hanging://", Timeout: 2, TotalTimeout: 10}, logger,
+			WithClock(clock))
+		require.Error(t, err)
+
+		// attempts at 0s, 3s and 6s run for 2s each; the one at 9s is cut to the remaining second
+		attemptsMade(t, attempts, 4)
+		require.Equal(t, 10*time.Second, clock.elapsed())
+		require.Contains(t, err.Error(), "connection attempt timed out after 1s")
+		require.True(t, errors.Is(err, ErrConnectTimeout))
+	})
+
+	t.Run("read from env", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app", Timeout: 2})
+		defer unsetEnv(t)
+		require.NoError(t, os.Setenv(DatabaseTotalTimeoutEnvKey, "60"))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), params.Timeout)
+		require.Equal(t, uint64(60), params.TotalTimeout)
+	})
+}
+
+func attemptsMade(t *testing.T, attempts *int32, expected int32) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(attempts) == expected
+	}, time.Second, time.Millisecond)
+}
+
+func TestWaitForStore(t *testing.T) {
+	t.Run("connects once the storage is ready", func(t *testing.T) {
+		var calls int32
+
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			if atomic.AddInt32(&calls, 1) <= 3 {
+				return nil, errors.New("container starting")
+			}
+
+			return mem.NewProvider(), nil
+		})
+
+		p, err := waitForStore(context.Background(), &DBParameters{URL: "fake://test", Timeout: 1}, logger,
+			time.Second, newFakeClock())
+		require.NoError(t, err)
+		require.NotNil(t, p)
+		require.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("gives up when the context is done", func(t *testing.T) {
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, errors.New("container starting")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		p, err := waitForStore(ctx, &DBParameters{URL: "fake://test", Timeout: 1}, logger, time.Second,
+			newFakeClock())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "container starting")
+		require.Nil(t, p)
+	})
+
+	t.Run("context bounds the retries of a connection", func(t *testing.T) {
+		registerTestFactory(t, "fake", func(string, *DBParameters) (storage.Provider, error) {
+			return nil, errors.New("container starting")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// the clock never ticks, so only ctx can end the waits between the attempts
+		_, err := waitForStore(ctx, &DBParameters{URL: "fake://test", Timeout: 30}, logger, time.Second,
+			&manualClock{ticks: make(chan time.Time)})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("unsupported driver fails at once", func(t *testing.T) {
+		_, err := WaitForStore(context.Background(), &DBParameters{URL: "redis://test"}, logger, time.Second)
+		require.EqualError(t, err, "unsupported storage driver: redis")
+	})
+}
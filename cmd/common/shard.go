@@ -0,0 +1,370 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// shardVirtualNodes is the number of points each shard has on the hash ring, so that keys spread evenly.
+const shardVirtualNodes = 128
+
+// BuildShardedProvider builds a provider with BuildProvider for each of params and spreads the keys of every store
+// across them by consistent hashing: a key is always read from and written to the same shard, as long as params
+// lists the same shards in the same order. Stores are opened on every shard. Queries run on every shard, one after
+// the other, so their results are not sorted across shards, and batches are only atomic within a shard. opts apply
+// to every shard.
+func BuildShardedProvider(params []*DBParameters, logger log.Logger, opts ...BuildOption) (storage.Provider, error) {
+	if len(params) == 0 {
+		return nil, errors.New("build sharded provider: no shards")
+	}
+
+	shards := make([]storage.Provider, 0, len(params))
+
+	for i, shardParams := range params {
+		shard, err := BuildProvider(shardParams, logger, opts...)
+		if err != nil {
+			for _, built := range shards {
+				_ = built.Close() // nolint:errcheck
+			}
+
+			return nil, fmt.Errorf("build shard %d: %w", i, err)
+		}
+
+		shards = append(shards, shard)
+	}
+
+	return &shardedProvider{shards: shards, ring: newHashRing(len(shards))}, nil
+}
+
+// hashRing maps keys to shard indexes by consistent hashing.
+type hashRing struct {
+	points []uint32
+	shards []int
+}
+
+func newHashRing(shards int) *hashRing {
+	ring := &hashRing{}
+
+	type point struct {
+		hash  uint32
+		shard int
+	}
+
+	points := make([]point, 0, shards*shardVirtualNodes)
+
+	for shard := 0; shard < shards; shard++ {
+		for node := 0; node < shardVirtualNodes; node++ {
+			points = append(points, point{hash: ringHash(strconv.Itoa(shard) + "-" + strconv.Itoa(node)), shard: shard})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	for _, p := range points {
+		ring.points = append(ring.points, p.hash)
+		ring.shards = append(ring.shards, p.shard)
+	}
+
+	return ring
+}
+
+// shard returns the index of the shard holding key: that of the first point at or after the hash of key.
+func (r *hashRing) shard(key string) int {
+	hash := ringHash(key)
+
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.shards[i]
+}
+
+func ringHash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s)) // nolint:errcheck
+
+	return h.Sum32()
+}
+
+type shardedProvider struct {
+	shards []storage.Provider
+	ring   *hashRing
+}
+
+func (p *shardedProvider) OpenStore(name string) (storage.Store, error) {
+	stores := make([]storage.Store, len(p.shards))
+
+	for i, shard := range p.shards {
+		store, err := shard.OpenStore(name)
+		if err != nil {
+			return nil, fmt.Errorf("open store %s on shard %d: %w", name, i, err)
+		}
+
+		stores[i] = store
+	}
+
+	return &shardedStore{stores: stores, ring: p.ring}, nil
+}
+
+func (p *shardedProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	for i, shard := range p.shards {
+		if err := shard.SetStoreConfig(name, config); err != nil {
+			return fmt.Errorf("set store config %s on shard %d: %w", name, i, err)
+		}
+	}
+
+	return nil
+}
+
+// GetStoreConfig returns the configuration of the store on the first shard, SetStoreConfig setting the same on
+// all of them.
+func (p *shardedProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	return p.shards[0].GetStoreConfig(name)
+}
+
+// GetOpenStores returns the stores open on the first shard, every store being opened on all of them.
+func (p *shardedProvider) GetOpenStores() []storage.Store {
+	return p.shards[0].GetOpenStores()
+}
+
+// openStoreNames returns the sorted names of the stores opened on the shards, every store being opened on all of
+// them.
+func (p *shardedProvider) openStoreNames() []string {
+	if lister, ok := p.shards[0].(storeNameLister); ok {
+		return lister.openStoreNames()
+	}
+
+	return nil
+}
+
+// tagsEntries reports whether every shard was built WithEntryTagging.
+func (p *shardedProvider) tagsEntries() bool {
+	for _, shard := range p.shards {
+		if !tagsEntries(shard) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *shardedProvider) Close() error {
+	var errs multiError
+
+	for _, shard := range p.shards {
+		if err := shard.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
+
+type shardedStore struct {
+	stores []storage.Store
+	ring   *hashRing
+}
+
+func (s *shardedStore) tagsEntries() bool {
+	for _, store := range s.stores {
+		if !tagsEntries(store) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *shardedStore) store(key string) storage.Store {
+	return s.stores[s.ring.shard(key)]
+}
+
+func (s *shardedStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.store(key).Put(key, value, tags...)
+}
+
+func (s *shardedStore) Get(key string) ([]byte, error) {
+	return s.store(key).Get(key)
+}
+
+func (s *shardedStore) GetTags(key string) ([]storage.Tag, error) {
+	return s.store(key).GetTags(key)
+}
+
+func (s *shardedStore) GetBulk(keys ...string) ([][]byte, error) {
+	positions := map[int][]int{}
+
+	for i, key := range keys {
+		shard := s.ring.shard(key)
+		positions[shard] = append(positions[shard], i)
+	}
+
+	values := make([][]byte, len(keys))
+
+	for shard, indexes := range positions {
+		shardKeys := make([]string, len(indexes))
+
+		for i, index := range indexes {
+			shardKeys[i] = keys[index]
+		}
+
+		shardValues, err := s.stores[shard].GetBulk(shardKeys...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, index := range indexes {
+			values[index] = shardValues[i]
+		}
+	}
+
+	return values, nil
+}
+
+func (s *shardedStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterators := make([]storage.Iterator, 0, len(s.stores))
+
+	for _, store := range s.stores {
+		iterator, err := store.Query(expression, options...)
+		if err != nil {
+			for _, opened := range iterators {
+				_ = opened.Close() // nolint:errcheck
+			}
+
+			return nil, err
+		}
+
+		iterators = append(iterators, iterator)
+	}
+
+	return &shardedIterator{iterators: iterators}, nil
+}
+
+func (s *shardedStore) Delete(key string) error {
+	return s.store(key).Delete(key)
+}
+
+// Batch splits operations by shard, keeping their order within each shard.
+func (s *shardedStore) Batch(operations []storage.Operation) error {
+	byShard := make([][]storage.Operation, len(s.stores))
+
+	for _, op := range operations {
+		shard := s.ring.shard(op.Key)
+		byShard[shard] = append(byShard[shard], op)
+	}
+
+	for shard, ops := range byShard {
+		if len(ops) == 0 {
+			continue
+		}
+
+		if err := s.stores[shard].Batch(ops); err != nil {
+			return fmt.Errorf("batch on shard %d: %w", shard, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *shardedStore) Flush() error {
+	return s.each(storage.Store.Flush)
+}
+
+func (s *shardedStore) Close() error {
+	return s.each(storage.Store.Close)
+}
+
+func (s *shardedStore) each(fn func(storage.Store) error) error {
+	var errs multiError
+
+	for _, store := range s.stores {
+		if err := fn(store); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
+
+// shardedIterator iterates over the results of each shard in turn.
+type shardedIterator struct {
+	iterators []storage.Iterator
+	current   int
+}
+
+func (i *shardedIterator) Next() (bool, error) {
+	for ; i.current < len(i.iterators); i.current++ {
+		ok, err := i.iterators[i.current].Next()
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func (i *shardedIterator) Key() (string, error) {
+	return i.iterators[i.currentIndex()].Key()
+}
+
+func (i *shardedIterator) Value() ([]byte, error) {
+	return i.iterators[i.currentIndex()].Value()
+}
+
+func (i *shardedIterator) Tags() ([]storage.Tag, error) {
+	return i.iterators[i.currentIndex()].Tags()
+}
+
+// currentIndex is the index of the iterator positioned by the last call to Next, or of the last one once all
+// are exhausted.
+func (i *shardedIterator) currentIndex() int {
+	if i.current >= len(i.iterators) {
+		return len(i.iterators) - 1
+	}
+
+	return i.current
+}
+
+func (i *shardedIterator) TotalItems() (int, error) {
+	var total int
+
+	for _, iterator := range i.iterators {
+		items, err := iterator.TotalItems()
+		if err != nil {
+			return 0, err
+		}
+
+		total += items
+	}
+
+	return total, nil
+}
+
+func (i *shardedIterator) Close() error {
+	var errs multiError
+
+	for _, iterator := range i.iterators {
+		if err := iterator.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
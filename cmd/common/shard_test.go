@@ -0,0 +1,135 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildShardedProvider(t *testing.T) {
+	const (
+		shardCount = 3
+		keyCount   = 60
+	)
+
+	build := func(t *testing.T) *shardedProvider {
+		t.Helper()
+
+		params := make([]*DBParameters, shardCount)
+		for i := range params {
+			params[i] = &DBParameters{URL: "mem://shard" + strconv.Itoa(i)}
+		}
+
+		p, err := BuildShardedProvider(params, logger)
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			require.NoError(t, p.Close())
+		})
+
+		return p.(*shardedProvider)
+	}
+
+	p := build(t)
+
+	store, err := p.OpenStore("sharded")
+	require.NoError(t, err)
+
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		require.NoError(t, store.Put(keys[i], []byte("value"+strconv.Itoa(i)), EntryTag))
+	}
+
+	t.Run("each key is on its shard only", func(t *testing.T) {
+		perShard := make([]int, shardCount)
+
+		for _, key := range keys {
+			owner := p.ring.shard(key)
+			perShard[owner]++
+
+			for i, shard := range p.shards {
+				shardStore, openErr := shard.OpenStore("sharded")
+				require.NoError(t, openErr)
+
+				_, getErr := shardStore.Get(key)
+				if i == owner {
+					require.NoError(t, getErr, key)
+				} else {
+					require.True(t, errors.Is(getErr, storage.ErrDataNotFound), key)
+				}
+			}
+		}
+
+		for i, count := range perShard {
+			require.NotZero(t, count, "shard %d holds no key", i)
+		}
+	})
+
+	t.Run("routing is deterministic", func(t *testing.T) {
+		other := build(t)
+
+		for _, key := range keys {
+			require.Equal(t, p.ring.shard(key), other.ring.shard(key), key)
+		}
+	})
+
+	t.Run("all keys are retrievable", func(t *testing.T) {
+		for i, key := range keys {
+			value, getErr := store.Get(key)
+			require.NoError(t, getErr)
+			require.Equal(t, "value"+strconv.Itoa(i), string(value))
+		}
+
+		values, bulkErr := store.GetBulk(keys...)
+		require.NoError(t, bulkErr)
+
+		for i, value := range values {
+			require.Equal(t, "value"+strconv.Itoa(i), string(value))
+		}
+
+		stats, statsErr := StoreStats(context.Background(), store)
+		require.NoError(t, statsErr)
+		require.Equal(t, keyCount, stats.Entries)
+	})
+
+	t.Run("batch and delete", func(t *testing.T) {
+		require.NoError(t, store.Batch([]storage.Operation{
+			{Key: keys[0], Value: []byte("batched")},
+			{Key: keys[1]},
+		}))
+
+		value, getErr := store.Get(keys[0])
+		require.NoError(t, getErr)
+		require.Equal(t, "batched", string(value))
+
+		_, getErr = store.Get(keys[1])
+		require.True(t, errors.Is(getErr, storage.ErrDataNotFound))
+
+		require.NoError(t, store.Delete(keys[0]))
+
+		_, getErr = store.Get(keys[0])
+		require.True(t, errors.Is(getErr, storage.ErrDataNotFound))
+	})
+
+	t.Run("no shards", func(t *testing.T) {
+		_, buildErr := BuildShardedProvider(nil, logger)
+		require.EqualError(t, buildErr, "build sharded provider: no shards")
+	})
+
+	t.Run("shard build error", func(t *testing.T) {
+		_, buildErr := BuildShardedProvider([]*DBParameters{{URL: "mem://ok"}, {URL: "unknown://db"}}, logger)
+		require.Error(t, buildErr)
+		require.Contains(t, buildErr.Error(), "build shard 1: ")
+	})
+}
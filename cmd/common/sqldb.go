@@ -0,0 +1,56 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// SQLDBProvider is implemented by the providers of SQL drivers that expose their database handle.
+type SQLDBProvider interface {
+	DB() *sql.DB
+}
+
+// RawSQLDB returns the database handle of p, or of the connection of a provider returned by BuildProvider, if
+// its driver implements SQLDBProvider, and ErrUnsupportedOperation otherwise.
+//
+// This is an escape hatch for queries that the storage API cannot express: statements run on the handle bypass
+// the prefix, the options of BuildProvider and the table layout guarantees of the driver, so they may break with
+// any driver upgrade. The handle belongs to the provider and must not be closed. Providers built WithLazyConnect
+// or WithIdleClose do not expose it, their connection changing over time.
+//
+// The mysql driver in use keeps its own handles private, so its providers come with a handle of their own on the
+// server of the dbURL, with a separate connection pool: statements name the databases of the stores, which are
+// the store names with the prefix.
+func RawSQLDB(p storage.Provider) (*sql.DB, error) {
+	if sqlProvider, ok := driverProvider(p).(SQLDBProvider); ok {
+		return sqlProvider.DB(), nil
+	}
+
+	return nil, fmt.Errorf("raw SQL database: %w", ErrUnsupportedOperation)
+}
+
+// driverProvider returns the provider of the driver behind p: the connection of a provider returned by
+// BuildProvider, if it has a fixed one, and the primary of a replicated provider, or p itself.
+func driverProvider(p storage.Provider) storage.Provider {
+	if built, ok := p.(interface{ connection() storage.Provider }); ok && built.connection() != nil {
+		p = built.connection()
+	}
+
+	if replicated, ok := p.(*replicatedProvider); ok {
+		p = replicated.Provider
+	}
+
+	return p
+}
+
+func (p *builtProvider) connection() storage.Provider {
+	return p.conn
+}
@@ -0,0 +1,217 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawSQLDB(t *testing.T) {
+	db := &sql.DB{}
+
+	registerTestFactory(t, "fakesql", func(string, *DBParameters) (storage.Provider, error) {
+		return &sqlProvider{Provider: mem.NewProvider(), db: db}, nil
+	})
+
+	t.Run("SQL provider", func(t *testing.T) {
+		raw, err := RawSQLDB(&sqlProvider{Provider: mem.NewProvider(), db: db})
+		require.NoError(t, err)
+		require.Same(t, db, raw)
+	})
+
+	t.Run("built SQL provider", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://test"}, logger, WithErrorContext(), WithOperationHistory(1))
+		require.NoError(t, err)
+
+		raw, err := RawSQLDB(p)
+		require.NoError(t, err)
+		require.Same(t, db, raw)
+	})
+
+	t.Run("built SQL provider with replica", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://primary", ReplicaURL: "fakesql://replica"}, logger)
+		require.NoError(t, err)
+
+		raw, err := RawSQLDB(p)
+		require.NoError(t, err)
+		require.Same(t, db, raw)
+	})
+
+	t.Run("reconnecting provider", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://test"}, logger, WithIdleClose(time.Hour))
+		require.NoError(t, err)
+
+		defer p.Close() // nolint:errcheck
+
+		_, err = RawSQLDB(p)
+		require.True(t, errors.Is(err, ErrUnsupportedOperation))
+	})
+
+	t.Run("mem", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+
+		_, err = RawSQLDB(p)
+		require.True(t, errors.Is(err, ErrUnsupportedOperation))
+
+		_, err = RawSQLDB(mem.NewProvider())
+		require.True(t, errors.Is(err, ErrUnsupportedOperation))
+	})
+}
+
+type sqlProvider struct {
+	storage.Provider
+	db *sql.DB
+}
+
+func (p *sqlProvider) DB() *sql.DB {
+	return p.db
+}
+
+func TestPingQuery(t *testing.T) {
+	setup := func(t *testing.T, queryErr error) (*recordingConnector, *sql.DB) {
+		t.Helper()
+
+		connector := &recordingConnector{err: queryErr}
+		db := sql.OpenDB(connector)
+
+		t.Cleanup(func() { require.NoError(t, db.Close()) })
+
+		registerTestFactory(t, "fakesql", func(string, *DBParameters) (storage.Provider, error) {
+			return &sqlProvider{Provider: mem.NewProvider(), db: db}, nil
+		})
+
+		return connector, db
+	}
+
+	t.Run("configured query", func(t *testing.T) {
+		connector, _ := setup(t, nil)
+
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://test", PingQuery: "SELECT /* proxy */ 1"}, logger,
+			WithWaitForHealthy(time.Second))
+		require.NoError(t, err)
+		require.NoError(t, HealthCheck(context.Background(), p))
+		require.Equal(t, []string{"SELECT /* proxy */ 1", "SELECT /* proxy */ 1"}, connector.recorded())
+	})
+
+	t.Run("default query", func(t *testing.T) {
+		connector, db := setup(t, nil)
+
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://test"}, logger)
+		require.NoError(t, err)
+		require.NoError(t, HealthCheck(context.Background(), p))
+		require.NoError(t, HealthCheck(context.Background(), &sqlProvider{Provider: mem.NewProvider(), db: db}))
+		require.Equal(t, []string{DatabasePingQueryDefault, DatabasePingQueryDefault}, connector.recorded())
+	})
+
+	t.Run("failed query", func(t *testing.T) {
+		setup(t, errors.New("syntax error"))
+
+		p, err := BuildProvider(&DBParameters{URL: "fakesql://test"}, logger)
+		require.NoError(t, err)
+		require.EqualError(t, HealthCheck(context.Background(), p), "health check: ping query: syntax error")
+	})
+
+	t.Run("ignored for other drivers", func(t *testing.T) {
+		p, err := BuildProvider(&DBParameters{URL: "mem://test", PingQuery: "SELECT 1"}, logger)
+		require.NoError(t, err)
+		require.NoError(t, HealthCheck(context.Background(), p))
+	})
+
+	t.Run("read from env", func(t *testing.T) {
+		defer unsetEnv(t)
+
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		require.NoError(t, os.Setenv(DatabasePingQueryEnvKey, "SELECT 2"))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, "SELECT 2", params.PingQuery)
+	})
+}
+
+// recordingConnector is a database/sql connector whose connections record the queries run on them, which
+// return no rows, or err.
+type recordingConnector struct {
+	err     error
+	mutex   sync.Mutex
+	queries []string
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (c *recordingConnector) recorded() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string(nil), c.queries...)
+}
+
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.connector.mutex.Lock()
+	defer c.connector.mutex.Unlock()
+
+	c.connector.queries = append(c.connector.queries, query)
+
+	if c.connector.err != nil {
+		return nil, c.connector.err
+	}
+
+	return emptyRows{}, nil
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string {
+	return nil
+}
+
+func (emptyRows) Close() error {
+	return nil
+}
+
+func (emptyRows) Next([]driver.Value) error {
+	return io.EOF
+}
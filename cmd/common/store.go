@@ -0,0 +1,809 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// EntryTagName is the tag the store helpers query to enumerate the entries of a store. Values are visible to
+// the helpers when they were written with EntryTag, which providers built with WithEntryTagging add on Put.
+const EntryTagName = "entry"
+
+// EntryTag marks a value as enumerable by the store helpers.
+var EntryTag = storage.Tag{Name: EntryTagName} // nolint:gochecknoglobals
+
+// Positions of the prefix in the store names opened by OpenPrefixedStore, set with DatabasePrefixPositionEnvKey.
+const (
+	PrefixPositionPrefix = "prefix"
+	PrefixPositionSuffix = "suffix"
+)
+
+// ErrUnsupportedOperation is returned when the underlying driver does not support the requested operation.
+var ErrUnsupportedOperation = errors.New("unsupported operation")
+
+// ErrStoreNameTooLong is returned by OpenPrefixedStore for names longer than the driver allows, which the
+// backend would otherwise truncate into colliding names.
+var ErrStoreNameTooLong = errors.New("store name too long")
+
+// StoreOption configures how OpenPrefixedStore opens a store.
+type StoreOption func(opts *storeOptions)
+
+type storeOptions struct {
+	withoutPrefix bool
+}
+
+// WithoutPrefix makes OpenPrefixedStore open the store under its raw name, for stores shared outside the
+// configured prefix.
+func WithoutPrefix() StoreOption {
+	return func(opts *storeOptions) {
+		opts.withoutPrefix = true
+	}
+}
+
+// OpenPrefixedStore opens the store name under params.Prefix, joined as the SQL and CouchDB drivers do with
+// "_". It is meant for providers that don't apply the prefix themselves, such as mem. The prefix is appended
+// instead when params.PrefixPosition is PrefixPositionSuffix. Names longer than the driver of params.URL allows
+// are rejected with ErrStoreNameTooLong.
+func OpenPrefixedStore(p storage.Provider, params *DBParameters, name string,
+	opts ...StoreOption) (storage.Store, error) {
+	name = prefixedStoreName(params, name, opts...)
+
+	if err := checkStoreNameLength(params, name); err != nil {
+		return nil, err
+	}
+
+	store, err := p.OpenStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("open store %s: %w", name, err)
+	}
+
+	return store, nil
+}
+
+// prefixedStoreName returns the name OpenPrefixedStore opens the store name under.
+func prefixedStoreName(params *DBParameters, name string, opts ...StoreOption) string {
+	options := &storeOptions{}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if params.Prefix == "" || options.withoutPrefix {
+		return name
+	}
+
+	if params.PrefixPosition == PrefixPositionSuffix {
+		return name + "_" + params.Prefix
+	}
+
+	return params.Prefix + "_" + name
+}
+
+func checkStoreNameLength(params *DBParameters, name string) error {
+	// an invalid URL has no limit here; connecting to it reports the error
+	driver := driverName(params)
+
+	if limit := maxStoreNameLengths[driver]; limit > 0 && len(name) > limit {
+		return fmt.Errorf("%w: %s is %d characters long, %s allows at most %d",
+			ErrStoreNameTooLong, name, len(name), driver, limit)
+	}
+
+	return nil
+}
+
+// OpenPrefixedStoreWithTimeout opens the store name as OpenPrefixedStore does, giving its operations their own
+// timeout. On a provider built WithOperationTimeout, the timeout replaces that of the option for the store, as
+// WithStoreTimeouts does, for every handle on the store. Otherwise only the operations made through the returned
+// store are bounded, in the same way.
+func OpenPrefixedStoreWithTimeout(p storage.Provider, params *DBParameters, name string, timeout time.Duration,
+	opts ...StoreOption) (storage.Store, error) {
+	fullName := prefixedStoreName(params, name, opts...)
+
+	registered := false
+	if registry, ok := p.(storeTimeoutRegistry); ok {
+		registered = registry.setStoreTimeout(fullName, timeout)
+	}
+
+	store, err := OpenPrefixedStore(p, params, name, opts...)
+	if err != nil || registered {
+		return store, err
+	}
+
+	return &interceptedStore{
+		Store: store, name: fullName, intercept: operationTimeout(context.Background(), timeout, nil),
+	}, nil
+}
+
+// OpenDefaultStore opens params.StoreName, or DatabaseStoreNameDefault if it is not set, with OpenPrefixedStore.
+func OpenDefaultStore(p storage.Provider, params *DBParameters) (storage.Store, error) {
+	name := params.StoreName
+	if name == "" {
+		name = DatabaseStoreNameDefault
+	}
+
+	return OpenPrefixedStore(p, params, name)
+}
+
+// OpenStores opens each of names with OpenPrefixedStore, returning them by name. It fails on the first store
+// that cannot be opened.
+func OpenStores(p storage.Provider, params *DBParameters, names ...string) (map[string]storage.Store, error) {
+	stores := make(map[string]storage.Store, len(names))
+
+	for _, name := range names {
+		store, err := OpenPrefixedStore(p, params, name)
+		if err != nil {
+			return nil, err
+		}
+
+		stores[name] = store
+	}
+
+	return stores, nil
+}
+
+// warmUpKey is the key read by WarmUp. It is not expected to exist.
+const warmUpKey = "sandbox_warm_up"
+
+// WarmUp opens each of names with OpenPrefixedStore and reads a key from it, so that the connections and caches
+// of the driver are primed before the first requests are served. A missing key is expected; WarmUp fails on the
+// first store that cannot be opened or read, or when ctx is done.
+func WarmUp(ctx context.Context, p storage.Provider, params *DBParameters, names ...string) error {
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		store, err := OpenPrefixedStore(p, params, name)
+		if err != nil {
+			return fmt.Errorf("warm up: %w", err)
+		}
+
+		if _, err = store.Get(warmUpKey); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("warm up: read store %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// storeMarkerKey is the key written by MarkStores and read by RequireStores.
+const storeMarkerKey = "sandbox_store_marker"
+
+// ErrStoresMissing is returned by RequireStores when some of the stores have no marker.
+var ErrStoresMissing = errors.New("required stores are missing")
+
+// MarkStores writes a marker to each of names, opened with OpenPrefixedStore, so that RequireStores finds them.
+// It is meant to be the last step of the migration that creates the stores. The marker is not enumerable.
+func MarkStores(p storage.Provider, params *DBParameters, names ...string) error {
+	for _, name := range names {
+		store, err := OpenPrefixedStore(p, params, name)
+		if err != nil {
+			return fmt.Errorf("mark stores: %w", err)
+		}
+
+		if err = store.Put(storeMarkerKey, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+			return fmt.Errorf("mark stores: write store %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// RequireStores checks that each of names, opened with OpenPrefixedStore, holds the marker written by
+// MarkStores, so that a service can refuse to start on storage whose migration is incomplete: opening a store
+// creates it with most drivers, so a store that doesn't exist cannot be told apart otherwise. The error wraps
+// ErrStoresMissing and lists every store without a marker; other failures are returned as they occur, and
+// RequireStores stops when ctx is done.
+func RequireStores(ctx context.Context, p storage.Provider, params *DBParameters, names ...string) error {
+	var missing []string
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		store, err := OpenPrefixedStore(p, params, name)
+		if err != nil {
+			return fmt.Errorf("require stores: %w", err)
+		}
+
+		_, err = store.Get(storeMarkerKey)
+
+		switch {
+		case IsNotFound(err):
+			missing = append(missing, name)
+		case err != nil:
+			return fmt.Errorf("require stores: read store %s: %w", name, err)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrStoresMissing, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// StoreStatistics describes the approximate usage of a store.
+type StoreStatistics struct {
+	// Entries is the number of enumerable entries in the store.
+	Entries int
+	// SizeBytes is the size reported by the driver, or -1 if the driver doesn't expose it.
+	SizeBytes int64
+}
+
+// sizeReporter is implemented by stores whose driver can report their size in bytes.
+type sizeReporter interface {
+	SizeBytes() (int64, error)
+}
+
+// ForEach calls fn for every enumerable entry in store, stopping at the first error returned by fn or when ctx
+// is done. ErrUnsupportedOperation is returned if the driver cannot query the store. It only sees the entries
+// written with EntryTag, as the providers built WithEntryTagging write them all: others are skipped silently.
+func ForEach(ctx context.Context, store storage.Store, fn func(key string, value []byte) error) error {
+	iterator, err := store.Query(EntryTagName)
+	if err != nil {
+		return fmt.Errorf("%w: query entries: %s", ErrUnsupportedOperation, err)
+	}
+
+	defer iterator.Close() // nolint:errcheck
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		key, value, more, nextErr := nextEntry(iterator)
+		if nextErr != nil || !more {
+			return nextErr
+		}
+
+		if err = fn(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+func nextEntry(iterator storage.Iterator) (string, []byte, bool, error) {
+	more, err := iterator.Next()
+	if err != nil {
+		return "", nil, false, fmt.Errorf("iterate entries: %w", err)
+	}
+
+	if !more {
+		return "", nil, false, nil
+	}
+
+	key, err := iterator.Key()
+	if err != nil {
+		return "", nil, false, fmt.Errorf("read entry key: %w", err)
+	}
+
+	value, err := iterator.Value()
+	if err != nil {
+		return "", nil, false, fmt.Errorf("read entry value: %w", err)
+	}
+
+	return key, value, true, nil
+}
+
+// StoreStats returns the approximate usage of store. The entry count is gathered with ForEach, so it respects
+// ctx cancellation for large stores but leaves out the entries written without EntryTag; the size is included
+// only when the driver exposes it.
+func StoreStats(ctx context.Context, store storage.Store) (StoreStatistics, error) {
+	stats := StoreStatistics{SizeBytes: -1}
+
+	err := ForEach(ctx, store, func(string, []byte) error {
+		stats.Entries++
+
+		return nil
+	})
+	if err != nil {
+		return StoreStatistics{}, err
+	}
+
+	if reporter, ok := store.(sizeReporter); ok {
+		stats.SizeBytes, err = reporter.SizeBytes()
+		if err != nil {
+			return StoreStatistics{}, fmt.Errorf("get store size: %w", err)
+		}
+	}
+
+	return stats, nil
+}
+
+// keyPrefixLister is implemented by stores whose driver can list their keys by prefix natively.
+type keyPrefixLister interface {
+	KeysWithPrefix(keyPrefix string) ([]string, error)
+}
+
+// KeysWithPrefix returns the sorted keys of the enumerable entries of store that start with keyPrefix, all of
+// them for an empty keyPrefix, without reading their values. Stores whose driver lists keys by prefix are asked
+// to, others are scanned in full, stopping when ctx is done. ErrUnsupportedOperation is returned if the driver
+// can neither list nor query the store.
+func KeysWithPrefix(ctx context.Context, store storage.Store, keyPrefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		keys []string
+		err  error
+	)
+
+	if lister, ok := store.(keyPrefixLister); ok {
+		keys, err = lister.KeysWithPrefix(keyPrefix)
+	} else {
+		keys, err = scanKeysWithPrefix(ctx, store, keyPrefix)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("list keys: %w", err)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func scanKeysWithPrefix(ctx context.Context, store storage.Store, keyPrefix string) ([]string, error) {
+	iterator, err := store.Query(EntryTagName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: query entries: %s", ErrUnsupportedOperation, err)
+	}
+
+	defer iterator.Close() // nolint:errcheck
+
+	keys := []string{}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		more, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterate entries: %w", err)
+		}
+
+		if !more {
+			return keys, nil
+		}
+
+		key, err := iterator.Key()
+		if err != nil {
+			return nil, fmt.Errorf("read entry key: %w", err)
+		}
+
+		if strings.HasPrefix(key, keyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+}
+
+// WaitForEmpty polls store every poll until it has no enumerable entries and none of keys, returning the error
+// of ctx if ctx is done first. Entries written without EntryTag are not enumerable, so a store whose writers
+// don't tag them all, as the providers built WithEntryTagging do, can look empty while it still holds them: the
+// keys of such entries must be given to be waited for, which is checked with Get.
+func WaitForEmpty(ctx context.Context, store storage.Store, poll time.Duration, keys ...string) error {
+	return waitForEmpty(ctx, store, poll, systemClock{}, keys...)
+}
+
+func waitForEmpty(ctx context.Context, store storage.Store, poll time.Duration, clock Clock, keys ...string) error {
+	for {
+		empty, err := isEmpty(ctx, store)
+		if err == nil && empty {
+			empty, err = keysGone(store, keys)
+		}
+
+		if err != nil || empty {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(poll):
+		}
+	}
+}
+
+// errNotEmpty stops the iteration of isEmpty at the first entry.
+var errNotEmpty = errors.New("store not empty")
+
+func isEmpty(ctx context.Context, store storage.Store) (bool, error) {
+	err := ForEach(ctx, store, func(string, []byte) error {
+		return errNotEmpty
+	})
+	if errors.Is(err, errNotEmpty) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// keysGone reports whether none of keys is in store.
+func keysGone(store storage.Store, keys []string) (bool, error) {
+	for _, key := range keys {
+		_, err := store.Get(key)
+		if err == nil {
+			return false, nil
+		}
+
+		if !IsNotFound(err) {
+			return false, fmt.Errorf("get %s: %w", truncateKey(key), err)
+		}
+	}
+
+	return true, nil
+}
+
+// ErrClearNotAllowed is returned by ClearPrefix unless DBParameters.AllowClear is set.
+var ErrClearNotAllowed = errors.New("clearing storage is not allowed, set " + DatabaseAllowClearEnvKey + " to confirm")
+
+// storeNameLister is implemented by the providers returned by BuildProvider and BuildShardedProvider, which know
+// the names of the stores opened on them.
+type storeNameLister interface {
+	openStoreNames() []string
+}
+
+// entryTagger is implemented by the providers and stores of BuildProvider and BuildShardedProvider, which tell
+// whether they were built WithEntryTagging.
+type entryTagger interface {
+	tagsEntries() bool
+}
+
+// tagsEntries reports whether v, a provider or a store, writes every entry with EntryTag.
+func tagsEntries(v interface{}) bool {
+	tagger, ok := v.(entryTagger)
+
+	return ok && tagger.tagsEntries()
+}
+
+// ClearPrefix deletes the entries of the stores under params.Prefix that were opened on p, as returned by
+// BuildProvider or BuildShardedProvider: all of them for the drivers that apply the prefix themselves, such as
+// CouchDB and MySQL, the stores whose name carries the prefix, as OpenPrefixedStore opens them, for the others.
+// It refuses to run unless params.AllowClear is set, and without a prefix.
+//
+// It does not clear the whole prefix: the storage API can neither list stores nor entries, so stores that were
+// never opened on p are left alone, as are the entries written without EntryTag, such as those written before p
+// or by other writers. ErrUnsupportedOperation is returned unless p was built WithEntryTagging, without which
+// none of the entries written through it could be found, and ErrNotBuiltProvider for other providers.
+func ClearPrefix(ctx context.Context, p storage.Provider, params *DBParameters) error {
+	if !params.AllowClear {
+		return ErrClearNotAllowed
+	}
+
+	if params.Prefix == "" {
+		return errors.New("clear prefix: no prefix configured")
+	}
+
+	lister, ok := p.(storeNameLister)
+	if !ok {
+		return ErrNotBuiltProvider
+	}
+
+	if !tagsEntries(p) {
+		return fmt.Errorf("clear prefix: %w: the provider isn't built WithEntryTagging", ErrUnsupportedOperation)
+	}
+
+	for _, name := range lister.openStoreNames() {
+		if !prefixingDrivers[driverName(params)] && !hasStorePrefix(params, name) {
+			continue
+		}
+
+		// the store is opened again, so that sharded providers clear it on every shard
+		store, err := p.OpenStore(name)
+		if err != nil {
+			return fmt.Errorf("open store %s: %w", name, err)
+		}
+
+		if err = clearStore(ctx, store); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasStorePrefix reports whether the store name carries params.Prefix as OpenPrefixedStore applies it.
+func hasStorePrefix(params *DBParameters, name string) bool {
+	if params.PrefixPosition == PrefixPositionSuffix {
+		return strings.HasSuffix(name, "_"+params.Prefix)
+	}
+
+	return strings.HasPrefix(name, params.Prefix+"_")
+}
+
+func clearStore(ctx context.Context, store storage.Store) error {
+	var keys []string
+
+	err := ForEach(ctx, store, func(key string, _ []byte) error {
+		keys = append(keys, key)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = store.Delete(key); err != nil {
+			return fmt.Errorf("delete %s: %w", truncateKey(key), err)
+		}
+	}
+
+	return nil
+}
+
+// tempStorePrefix starts the names of the stores opened by WithTempStore.
+const tempStorePrefix = "tmp_"
+
+// tempStoreCount makes the names of the stores opened by WithTempStore unique within the process.
+var tempStoreCount uint64 // nolint:gochecknoglobals
+
+// WithTempStore opens a store of a unique name on p and runs fn with it, then deletes the entries written through
+// it and its enumerable entries, even when fn fails or panics, so that tests don't leave data behind. The storage
+// API cannot drop a store, so the empty store remains. The error of fn is returned along with that of the
+// cleanup, whose scan of the enumerable entries stops when ctx is done.
+func WithTempStore(ctx context.Context, p storage.Provider, fn func(store storage.Store) error) (err error) {
+	name := tempStorePrefix + strconv.FormatInt(time.Now().UnixNano(), 10) + "_" +
+		strconv.FormatUint(atomic.AddUint64(&tempStoreCount, 1), 10)
+
+	store, err := p.OpenStore(name)
+	if err != nil {
+		return fmt.Errorf("open temp store %s: %w", name, err)
+	}
+
+	temp := &tempStore{Store: store, written: map[string]bool{}}
+
+	defer func() {
+		if cleanupErr := temp.cleanup(ctx); cleanupErr != nil {
+			cleanupErr = fmt.Errorf("clean up temp store %s: %w", name, cleanupErr)
+
+			if err == nil {
+				err = cleanupErr
+			} else {
+				err = multiError{err, cleanupErr}
+			}
+		}
+	}()
+
+	return fn(temp)
+}
+
+// tempStore records the keys written to a store opened by WithTempStore, including those that are not
+// enumerable, so that they can be deleted.
+type tempStore struct {
+	storage.Store
+	mutex   sync.Mutex
+	written map[string]bool
+}
+
+func (s *tempStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	s.record(key)
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *tempStore) Batch(operations []storage.Operation) error {
+	for _, op := range operations {
+		s.record(op.Key)
+	}
+
+	return s.Store.Batch(operations)
+}
+
+func (s *tempStore) record(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.written[key] = true
+}
+
+func (s *tempStore) cleanup(ctx context.Context) error {
+	s.mutex.Lock()
+	keys := s.written
+	s.mutex.Unlock()
+
+	// the recorded keys are deleted even if the scan fails
+	scanErr := ForEach(ctx, s.Store, func(key string, _ []byte) error {
+		keys[key] = true
+
+		return nil
+	})
+	if errors.Is(scanErr, ErrUnsupportedOperation) {
+		scanErr = nil
+	}
+
+	for key := range keys {
+		if err := s.Store.Delete(key); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("delete %s: %w", truncateKey(key), err)
+		}
+	}
+
+	return scanErr
+}
+
+// SnapshotEntry is an entry captured by Snapshot.
+type SnapshotEntry struct {
+	Value []byte
+	Tags  []storage.Tag
+}
+
+// Snapshot captures the enumerable entries of store, with their tags, so that they can be reapplied with Restore.
+// Entries written without EntryTag are not captured.
+func Snapshot(store storage.Store) (map[string]SnapshotEntry, error) {
+	snap := map[string]SnapshotEntry{}
+
+	err := ForEach(context.Background(), store, func(key string, value []byte) error {
+		tags, err := store.GetTags(key)
+		if err != nil {
+			return fmt.Errorf("read tags of %s: %w", truncateKey(key), err)
+		}
+
+		snap[key] = SnapshotEntry{Value: value, Tags: tags}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// Restore returns store to the state captured by Snapshot, deleting the enumerable entries that are not in
+// snap and writing the others back with their tags. Entries written without EntryTag since the snapshot are left
+// in place.
+func Restore(store storage.Store, snap map[string]SnapshotEntry) error {
+	var operations []storage.Operation
+
+	err := ForEach(context.Background(), store, func(key string, _ []byte) error {
+		if _, ok := snap[key]; !ok {
+			operations = append(operations, storage.Operation{Key: key})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, entry := range snap {
+		operations = append(operations, storage.Operation{Key: key, Value: entry.Value, Tags: withEntryTag(entry.Tags)})
+	}
+
+	if err = store.Batch(operations); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// GetOrCreate returns the value of key in store or, if there is none, the value returned by create, which it
+// writes tagged with EntryTag before returning it. Errors other than a missing key, as told by IsNotFound, are
+// returned without calling create, as are the errors of create, in which case nothing is written. The read and
+// the write are separate operations: on backends without atomic conditional writes, concurrent callers may all
+// run create, and the last write wins, so create should be idempotent or its result interchangeable.
+func GetOrCreate(ctx context.Context, store storage.Store, key string, create func() ([]byte, error)) ([]byte, error) {
+	value, err := store.Get(key)
+	if err == nil {
+		return value, nil
+	}
+
+	if !IsNotFound(err) {
+		return nil, fmt.Errorf("get %s: %w", truncateKey(key), err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	value, err = create()
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", truncateKey(key), err)
+	}
+
+	if err = store.Put(key, value, EntryTag); err != nil {
+		return nil, fmt.Errorf("put %s: %w", truncateKey(key), err)
+	}
+
+	return value, nil
+}
+
+// EqualContents compares the entries of a and b, returning whether they match and, sorted, the keys that are
+// missing from either store or whose values differ. Tags are not compared.
+//
+// The stores must be opened on providers built WithEntryTagging, so that every entry written through them can be
+// enumerated; ErrUnsupportedOperation is returned for others, whose untagged entries would go unnoticed. Entries
+// written without EntryTag by other means, such as before entry tagging was enabled, are still not compared.
+func EqualContents(ctx context.Context, a, b storage.Store) (bool, []string, error) {
+	if !tagsEntries(a) || !tagsEntries(b) {
+		return false, nil, fmt.Errorf("equal contents: %w: the stores aren't opened on providers built "+
+			"WithEntryTagging", ErrUnsupportedOperation)
+	}
+
+	entries := map[string][]byte{}
+
+	err := ForEach(ctx, a, func(key string, value []byte) error {
+		entries[key] = value
+
+		return nil
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("read first store: %w", err)
+	}
+
+	var differing []string
+
+	err = ForEach(ctx, b, func(key string, value []byte) error {
+		expected, ok := entries[key]
+		if !ok || !bytes.Equal(expected, value) {
+			differing = append(differing, key)
+		}
+
+		delete(entries, key)
+
+		return nil
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("read second store: %w", err)
+	}
+
+	for key := range entries {
+		differing = append(differing, key)
+	}
+
+	sort.Strings(differing)
+
+	return len(differing) == 0, differing, nil
+}
+
+// FindDuplicateKeys opens each of stores on p and returns the keys enumerable in more than one of them, mapped to
+// the names of the stores holding them in the order of stores. Keys found in a single store are left out.
+func FindDuplicateKeys(ctx context.Context, p storage.Provider, stores []string) (map[string][]string, error) {
+	holders := map[string][]string{}
+
+	for _, name := range stores {
+		store, err := p.OpenStore(name)
+		if err != nil {
+			return nil, fmt.Errorf("find duplicate keys: open store %s: %w", name, err)
+		}
+
+		err = ForEach(ctx, store, func(key string, _ []byte) error {
+			holders[key] = append(holders[key], name)
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("find duplicate keys: read store %s: %w", name, err)
+		}
+	}
+
+	duplicates := map[string][]string{}
+
+	for key, names := range holders {
+		if len(names) > 1 {
+			duplicates[key] = names
+		}
+	}
+
+	return duplicates, nil
+}
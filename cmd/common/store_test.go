@@ -0,0 +1,975 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreStats(t *testing.T) {
+	t.Run("counts entries of a seeded store", func(t *testing.T) {
+		store := seededStore(t, map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"})
+		require.NoError(t, store.Put("untagged", []byte("ignored")))
+
+		stats, err := StoreStats(context.Background(), store)
+		require.NoError(t, err)
+		require.Equal(t, 3, stats.Entries)
+		require.EqualValues(t, -1, stats.SizeBytes)
+	})
+
+	t.Run("includes size when the driver reports it", func(t *testing.T) {
+		store := &sizedStore{Store: seededStore(t, map[string]string{"k1": "v1"}), size: 42}
+
+		stats, err := StoreStats(context.Background(), store)
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Entries)
+		require.EqualValues(t, 42, stats.SizeBytes)
+	})
+
+	t.Run("unsupported if the driver cannot query", func(t *testing.T) {
+		_, err := StoreStats(context.Background(), &failingStore{err: errors.New("query not supported")})
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+	})
+
+	t.Run("respects context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := StoreStats(ctx, seededStore(t, map[string]string{"k1": "v1"}))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestWithEntryTagging(t *testing.T) {
+	p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithEntryTagging())
+	require.NoError(t, err)
+
+	store, err := p.OpenStore("store")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("k1", []byte("v1"), storage.Tag{Name: "other"}))
+	require.NoError(t, store.Batch([]storage.Operation{{Key: "k2", Value: []byte("v2")}, {Key: "k1"}}))
+
+	stats, err := StoreStats(context.Background(), store)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Entries)
+
+	tags, err := store.GetTags("k2")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Tag{EntryTag}, tags)
+}
+
+func TestOpenPrefixedStore(t *testing.T) {
+	params := &DBParameters{Prefix: "app"}
+
+	t.Run("applies the prefix", func(t *testing.T) {
+		p := &mockProvider{store: &mockStore{}}
+
+		_, err := OpenPrefixedStore(p, params, "users")
+		require.NoError(t, err)
+		require.Equal(t, []string{"app_users"}, p.opened)
+	})
+
+	t.Run("prefix positions", func(t *testing.T) {
+		for position, expected := range map[string]string{
+			"":                   "app_users",
+			PrefixPositionPrefix: "app_users",
+			PrefixPositionSuffix: "users_app",
+		} {
+			p := &mockProvider{store: &mockStore{}}
+
+			_, err := OpenPrefixedStore(p, &DBParameters{Prefix: "app", PrefixPosition: position}, "users")
+			require.NoError(t, err)
+			require.Equal(t, []string{expected}, p.opened, position)
+		}
+	})
+
+	t.Run("prefix position from env", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		require.NoError(t, os.Setenv(DatabasePrefixPositionEnvKey, "Suffix"))
+		configured, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, PrefixPositionSuffix, configured.PrefixPosition)
+
+		require.NoError(t, os.Setenv(DatabasePrefixPositionEnvKey, "middle"))
+		_, err = DBParams(cmd)
+		require.EqualError(t, err, "failed to configure dbPrefixPosition: unknown position middle, "+
+			"it must be prefix or suffix")
+	})
+
+	t.Run("without prefix opens the raw name", func(t *testing.T) {
+		p := &mockProvider{store: &mockStore{}}
+
+		_, err := OpenPrefixedStore(p, params, "config", WithoutPrefix())
+		require.NoError(t, err)
+		require.Equal(t, []string{"config"}, p.opened)
+	})
+
+	t.Run("no prefix configured", func(t *testing.T) {
+		p := &mockProvider{store: &mockStore{}}
+
+		_, err := OpenPrefixedStore(p, &DBParameters{}, "users")
+		require.NoError(t, err)
+		require.Equal(t, []string{"users"}, p.opened)
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		_, err := OpenPrefixedStore(&mockProvider{openErr: errors.New("closed")}, params, "users")
+		require.EqualError(t, err, "open store app_users: closed")
+	})
+}
+
+func TestStoreNameLength(t *testing.T) {
+	requireDriver(t, "mysql")
+
+	params := &DBParameters{URL: "mysql://root@tcp(localhost:3306)/", Prefix: "tenant"}
+
+	t.Run("within the limit", func(t *testing.T) {
+		_, err := OpenPrefixedStore(mem.NewProvider(), params, strings.Repeat("a", 64-len("tenant_")))
+		require.NoError(t, err)
+	})
+
+	t.Run("exceeding the limit", func(t *testing.T) {
+		p := &mockProvider{}
+
+		_, err := OpenPrefixedStore(p, params, strings.Repeat("a", 64))
+		require.ErrorIs(t, err, ErrStoreNameTooLong)
+		require.Contains(t, err.Error(), "is 71 characters long, mysql allows at most 64")
+		require.Empty(t, p.opened)
+	})
+
+	t.Run("no limit for mem", func(t *testing.T) {
+		_, err := OpenPrefixedStore(mem.NewProvider(), &DBParameters{URL: "mem://test", Prefix: "tenant"},
+			strings.Repeat("a", 200))
+		require.NoError(t, err)
+	})
+}
+
+func TestOpenDefaultStore(t *testing.T) {
+	t.Run("applies the prefix", func(t *testing.T) {
+		p := &mockProvider{store: &mockStore{}}
+
+		_, err := OpenDefaultStore(p, &DBParameters{Prefix: "app", StoreName: "profiles"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"app_profiles"}, p.opened)
+	})
+
+	t.Run("default name", func(t *testing.T) {
+		p := &mockProvider{store: &mockStore{}}
+
+		_, err := OpenDefaultStore(p, &DBParameters{Prefix: "app"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"app_" + DatabaseStoreNameDefault}, p.opened)
+	})
+}
+
+func TestOpenStores(t *testing.T) {
+	t.Run("opens all stores", func(t *testing.T) {
+		p := mem.NewProvider()
+
+		stores, err := OpenStores(p, &DBParameters{Prefix: "app"}, "users", "sessions")
+		require.NoError(t, err)
+		require.Len(t, stores, 2)
+		require.NotNil(t, stores["users"])
+		require.NotNil(t, stores["sessions"])
+		require.Len(t, p.GetOpenStores(), 2)
+	})
+
+	t.Run("failing open surfaces the name", func(t *testing.T) {
+		_, err := OpenStores(&mockProvider{openErr: errors.New("closed")}, &DBParameters{Prefix: "app"}, "users")
+		require.EqualError(t, err, "open store app_users: closed")
+	})
+}
+
+func TestClearPrefix(t *testing.T) {
+	params := &DBParameters{URL: "mem://test", Prefix: "app", AllowClear: true}
+
+	seed := func(t *testing.T, p storage.Provider, names ...string) []storage.Store {
+		t.Helper()
+
+		var stores []storage.Store
+
+		for _, name := range names {
+			store, err := p.OpenStore(name)
+			require.NoError(t, err)
+			require.NoError(t, store.Put("k1", []byte("v1")))
+			require.NoError(t, store.Put("k2", []byte("v2")))
+
+			stores = append(stores, store)
+		}
+
+		return stores
+	}
+
+	requireEntries := func(t *testing.T, store storage.Store, entries int) {
+		t.Helper()
+
+		stats, err := StoreStats(context.Background(), store)
+		require.NoError(t, err)
+		require.Equal(t, entries, stats.Entries)
+	}
+
+	t.Run("deletes all data under the prefix", func(t *testing.T) {
+		p, err := BuildProvider(params, logger, WithEntryTagging())
+		require.NoError(t, err)
+
+		stores := seed(t, p, "app_users", "app_sessions", "other_users")
+
+		require.NoError(t, ClearPrefix(context.Background(), p, params))
+
+		requireEntries(t, stores[0], 0)
+		requireEntries(t, stores[1], 0)
+		requireEntries(t, stores[2], 2)
+	})
+
+	t.Run("prefix as suffix", func(t *testing.T) {
+		suffixed := &DBParameters{URL: "mem://test", Prefix: "app", PrefixPosition: PrefixPositionSuffix, AllowClear: true}
+
+		p, err := BuildProvider(suffixed, logger, WithEntryTagging())
+		require.NoError(t, err)
+
+		stores := seed(t, p, "users_app", "app_users")
+
+		require.NoError(t, ClearPrefix(context.Background(), p, suffixed))
+
+		requireEntries(t, stores[0], 0)
+		requireEntries(t, stores[1], 2)
+	})
+
+	t.Run("deletes the data on every shard", func(t *testing.T) {
+		p, err := BuildShardedProvider([]*DBParameters{params, params}, logger, WithEntryTagging())
+		require.NoError(t, err)
+
+		store := seed(t, p, "app_users")[0]
+		require.NoError(t, store.Put("k3", []byte("v3")))
+		require.NoError(t, store.Put("k4", []byte("v4")))
+
+		require.NoError(t, ClearPrefix(context.Background(), p, params))
+
+		requireEntries(t, store, 0)
+	})
+
+	t.Run("refuses without confirmation", func(t *testing.T) {
+		p, err := BuildProvider(params, logger, WithEntryTagging())
+		require.NoError(t, err)
+
+		stores := seed(t, p, "app_users")
+
+		err = ClearPrefix(context.Background(), p, &DBParameters{URL: "mem://test", Prefix: "app"})
+		require.ErrorIs(t, err, ErrClearNotAllowed)
+
+		requireEntries(t, stores[0], 2)
+	})
+
+	t.Run("refuses without a prefix", func(t *testing.T) {
+		p, err := BuildProvider(params, logger, WithEntryTagging())
+		require.NoError(t, err)
+
+		err = ClearPrefix(context.Background(), p, &DBParameters{URL: "mem://test", AllowClear: true})
+		require.EqualError(t, err, "clear prefix: no prefix configured")
+	})
+
+	t.Run("refuses without entry tagging", func(t *testing.T) {
+		p, err := BuildProvider(params, logger)
+		require.NoError(t, err)
+
+		store, err := p.OpenStore("app_users")
+		require.NoError(t, err)
+		require.NoError(t, store.Put("k1", []byte("v1"), EntryTag))
+
+		err = ClearPrefix(context.Background(), p, params)
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+
+		requireEntries(t, store, 1)
+
+		sharded, err := BuildShardedProvider([]*DBParameters{params, params}, logger)
+		require.NoError(t, err)
+		require.ErrorIs(t, ClearPrefix(context.Background(), sharded, params), ErrUnsupportedOperation)
+	})
+
+	t.Run("provider not built", func(t *testing.T) {
+		err := ClearPrefix(context.Background(), mem.NewProvider(), params)
+		require.ErrorIs(t, err, ErrNotBuiltProvider)
+	})
+}
+
+func TestWaitForEmpty(t *testing.T) {
+	t.Run("returns once drained", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("queue")
+		require.NoError(t, err)
+
+		for _, key := range []string{"a", "b"} {
+			require.NoError(t, store.Put(key, []byte("job"), EntryTag))
+		}
+
+		clock := &manualClock{ticks: make(chan time.Time, 1)}
+
+		go func() {
+			for _, key := range []string{"a", "b"} {
+				require.NoError(t, store.Delete(key))
+			}
+
+			clock.ticks <- clock.Now()
+		}()
+
+		require.NoError(t, waitForEmpty(context.Background(), store, time.Second, clock))
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("queue")
+		require.NoError(t, err)
+		require.NoError(t, store.Put("a", []byte("job"), EntryTag))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err = waitForEmpty(ctx, store, time.Second, &manualClock{ticks: make(chan time.Time)})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("queue")
+		require.NoError(t, err)
+
+		require.NoError(t, WaitForEmpty(context.Background(), store, time.Second))
+	})
+
+	t.Run("untagged entries given by key", func(t *testing.T) {
+		store, err := mem.NewProvider().OpenStore("queue")
+		require.NoError(t, err)
+		require.NoError(t, store.Put("untagged", []byte("job")))
+
+		// the entry is not enumerable, only its key tells that the store is not empty
+		require.NoError(t, WaitForEmpty(context.Background(), store, time.Second))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err = waitForEmpty(ctx, store, time.Second, &manualClock{ticks: make(chan time.Time)}, "untagged")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		clock := &manualClock{ticks: make(chan time.Time, 1)}
+
+		go func() {
+			require.NoError(t, store.Delete("untagged"))
+
+			clock.ticks <- clock.Now()
+		}()
+
+		require.NoError(t, waitForEmpty(context.Background(), store, time.Second, clock, "untagged", "missing"))
+
+		_, err = store.Get("untagged")
+		require.True(t, IsNotFound(err))
+	})
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	store := seededStore(t, map[string]string{"a": "1"})
+	kind := storage.Tag{Name: "kind", Value: "user"}
+	require.NoError(t, store.Put("b", []byte("2"), EntryTag, kind))
+
+	snap, err := Snapshot(store)
+	require.NoError(t, err)
+	require.Equal(t, map[string]SnapshotEntry{
+		"a": {Value: []byte("1"), Tags: []storage.Tag{EntryTag}},
+		"b": {Value: []byte("2"), Tags: []storage.Tag{EntryTag, kind}},
+	}, snap)
+
+	require.NoError(t, store.Put("a", []byte("changed"), EntryTag))
+	require.NoError(t, store.Put("b", []byte("changed"), EntryTag))
+	require.NoError(t, store.Put("c", []byte("3"), EntryTag))
+
+	require.NoError(t, Restore(store, snap))
+
+	restored, err := Snapshot(store)
+	require.NoError(t, err)
+	require.Equal(t, snap, restored)
+
+	_, err = store.Get("c")
+	require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+	// the tag queries of the application still find the restored entries
+	iterator, err := store.Query("kind:user")
+	require.NoError(t, err)
+
+	more, err := iterator.Next()
+	require.NoError(t, err)
+	require.True(t, more)
+
+	key, err := iterator.Key()
+	require.NoError(t, err)
+	require.Equal(t, "b", key)
+	require.NoError(t, iterator.Close())
+
+	t.Run("error if store cannot be queried", func(t *testing.T) {
+		_, err = Snapshot(&failingStore{err: errors.New("no query")})
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+
+		require.ErrorIs(t, Restore(&failingStore{err: errors.New("no query")}, snap), ErrUnsupportedOperation)
+	})
+}
+
+// snapshotValues returns the values of the enumerable entries of store.
+func snapshotValues(t *testing.T, store storage.Store) map[string][]byte {
+	t.Helper()
+
+	snap, err := Snapshot(store)
+	require.NoError(t, err)
+
+	values := make(map[string][]byte, len(snap))
+	for key, entry := range snap {
+		values[key] = entry.Value
+	}
+
+	return values
+}
+
+// seededStore returns a mem store holding the given entries tagged with EntryTag.
+func seededStore(t *testing.T, entries map[string]string) storage.Store {
+	t.Helper()
+
+	store, err := mem.NewProvider().OpenStore("seeded")
+	require.NoError(t, err)
+
+	for k, v := range entries {
+		require.NoError(t, store.Put(k, []byte(v), EntryTag))
+	}
+
+	return store
+}
+
+type sizedStore struct {
+	storage.Store
+	size int64
+}
+
+func (s *sizedStore) SizeBytes() (int64, error) {
+	return s.size, nil
+}
+
+type failingStore struct {
+	storage.Store
+	err error
+}
+
+func (s *failingStore) Query(string, ...storage.QueryOption) (storage.Iterator, error) {
+	return nil, s.err
+}
+
+func TestFindDuplicateKeys(t *testing.T) {
+	ctx := context.Background()
+
+	seed := func(t *testing.T, stores map[string][]string) storage.Provider {
+		t.Helper()
+
+		p := mem.NewProvider()
+
+		for name, keys := range stores {
+			store, err := p.OpenStore(name)
+			require.NoError(t, err)
+
+			for _, key := range keys {
+				require.NoError(t, store.Put(key, []byte("value"), EntryTag))
+			}
+		}
+
+		return p
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		p := seed(t, map[string][]string{
+			"a": {"shared", "all", "only-a"},
+			"b": {"shared", "all"},
+			"c": {"all", "only-c"},
+		})
+
+		duplicates, err := FindDuplicateKeys(ctx, p, []string{"a", "b", "c"})
+		require.NoError(t, err)
+		require.Equal(t, map[string][]string{
+			"shared": {"a", "b"},
+			"all":    {"a", "b", "c"},
+		}, duplicates)
+	})
+
+	t.Run("no duplicates", func(t *testing.T) {
+		p := seed(t, map[string][]string{"a": {"k1", "k2"}, "b": {"k3"}})
+
+		duplicates, err := FindDuplicateKeys(ctx, p, []string{"a", "b"})
+		require.NoError(t, err)
+		require.Empty(t, duplicates)
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		_, err := FindDuplicateKeys(ctx, &mockProvider{openErr: errors.New("unavailable")}, []string{"a"})
+		require.EqualError(t, err, "find duplicate keys: open store a: unavailable")
+	})
+}
+
+func TestEqualContents(t *testing.T) {
+	ctx := context.Background()
+	source := map[string]string{"a": "1", "b": "2"}
+
+	tagged := func(t *testing.T, entries map[string]string) storage.Store {
+		t.Helper()
+
+		return &entryTaggedStore{Store: seededStore(t, entries)}
+	}
+
+	t.Run("identical stores", func(t *testing.T) {
+		equal, differing, err := EqualContents(ctx, tagged(t, source), tagged(t, source))
+		require.NoError(t, err)
+		require.True(t, equal)
+		require.Empty(t, differing)
+	})
+
+	t.Run("extra key", func(t *testing.T) {
+		equal, differing, err := EqualContents(ctx, tagged(t, source),
+			tagged(t, map[string]string{"a": "1", "b": "2", "c": "3"}))
+		require.NoError(t, err)
+		require.False(t, equal)
+		require.Equal(t, []string{"c"}, differing)
+
+		_, differing, err = EqualContents(ctx, tagged(t, map[string]string{"a": "1", "z": "0", "b": "2"}),
+			tagged(t, source))
+		require.NoError(t, err)
+		require.Equal(t, []string{"z"}, differing)
+	})
+
+	t.Run("differing value", func(t *testing.T) {
+		equal, differing, err := EqualContents(ctx, tagged(t, source),
+			tagged(t, map[string]string{"a": "1", "b": "changed"}))
+		require.NoError(t, err)
+		require.False(t, equal)
+		require.Equal(t, []string{"b"}, differing)
+	})
+
+	t.Run("stores of providers built WithEntryTagging", func(t *testing.T) {
+		stores := make([]storage.Store, 2)
+
+		for i := range stores {
+			p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger, WithEntryTagging())
+			require.NoError(t, err)
+
+			stores[i], err = p.OpenStore("users")
+			require.NoError(t, err)
+			require.NoError(t, stores[i].Put("a", []byte("1")))
+		}
+
+		require.NoError(t, stores[1].Put("b", []byte("2")))
+
+		equal, differing, err := EqualContents(ctx, stores[0], stores[1])
+		require.NoError(t, err)
+		require.False(t, equal)
+		require.Equal(t, []string{"b"}, differing)
+	})
+
+	t.Run("error if entries may be untagged", func(t *testing.T) {
+		untagged := seededStore(t, source)
+		require.NoError(t, untagged.Put("c", []byte("3")))
+
+		_, _, err := EqualContents(ctx, tagged(t, source), untagged)
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+
+		p, err := BuildProvider(&DBParameters{URL: "mem://test"}, logger)
+		require.NoError(t, err)
+
+		store, err := p.OpenStore("users")
+		require.NoError(t, err)
+
+		_, _, err = EqualContents(ctx, store, tagged(t, source))
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+	})
+
+	t.Run("error if a store cannot be queried", func(t *testing.T) {
+		failing := &entryTaggedStore{Store: &failingStore{err: errors.New("no query")}}
+
+		_, _, err := EqualContents(ctx, failing, tagged(t, source))
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+
+		_, _, err = EqualContents(ctx, tagged(t, source), failing)
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+		require.Contains(t, err.Error(), "read second store")
+	})
+}
+
+// entryTaggedStore is a store whose entries are all written with EntryTag, as if opened WithEntryTagging.
+type entryTaggedStore struct {
+	storage.Store
+}
+
+func (s *entryTaggedStore) tagsEntries() bool {
+	return true
+}
+
+func TestGetOrCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("existing value", func(t *testing.T) {
+		store := seededStore(t, map[string]string{"key": "existing"})
+
+		value, err := GetOrCreate(ctx, store, "key", func() ([]byte, error) {
+			require.Fail(t, "create must not run for an existing key")
+
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []byte("existing"), value)
+	})
+
+	t.Run("creates a missing value", func(t *testing.T) {
+		store := seededStore(t, nil)
+		calls := 0
+
+		create := func() ([]byte, error) {
+			calls++
+
+			return []byte("created"), nil
+		}
+
+		value, err := GetOrCreate(ctx, store, "key", create)
+		require.NoError(t, err)
+		require.Equal(t, []byte("created"), value)
+
+		value, err = GetOrCreate(ctx, store, "key", create)
+		require.NoError(t, err)
+		require.Equal(t, []byte("created"), value)
+		require.Equal(t, 1, calls)
+
+		stats, err := StoreStats(ctx, store)
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Entries)
+	})
+
+	t.Run("create error", func(t *testing.T) {
+		store := seededStore(t, nil)
+
+		_, err := GetOrCreate(ctx, store, "key", func() ([]byte, error) {
+			return nil, errors.New("no entropy")
+		})
+		require.EqualError(t, err, "create key: no entropy")
+
+		_, err = store.Get("key")
+		require.True(t, IsNotFound(err))
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		_, err := GetOrCreate(ctx, &mockStore{getErr: errors.New("timeout")}, "key", func() ([]byte, error) {
+			require.Fail(t, "create must not run after a read error")
+
+			return nil, nil
+		})
+		require.EqualError(t, err, "get key: timeout")
+	})
+}
+
+// readRecordingStore records the keys read from it, which are all missing.
+type readRecordingStore struct {
+	storage.Store
+	reads []string
+	err   error
+}
+
+func (s *readRecordingStore) Get(key string) ([]byte, error) {
+	s.reads = append(s.reads, key)
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return nil, storage.ErrDataNotFound
+}
+
+func TestWarmUp(t *testing.T) {
+	params := &DBParameters{Prefix: "app"}
+
+	t.Run("opens and reads each store", func(t *testing.T) {
+		store := &readRecordingStore{}
+		p := &mockProvider{store: store}
+
+		require.NoError(t, WarmUp(context.Background(), p, params, "users", "sessions"))
+		require.Equal(t, []string{"app_users", "app_sessions"}, p.opened)
+		require.Equal(t, []string{warmUpKey, warmUpKey}, store.reads)
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		err := WarmUp(context.Background(), &mockProvider{openErr: errors.New("offline")}, params, "users")
+		require.EqualError(t, err, "warm up: open store app_users: offline")
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		p := &mockProvider{store: &readRecordingStore{err: errors.New("timeout")}}
+
+		err := WarmUp(context.Background(), p, params, "users", "sessions")
+		require.EqualError(t, err, "warm up: read store users: timeout")
+		require.Equal(t, []string{"app_users"}, p.opened)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		p := &mockProvider{store: &readRecordingStore{}}
+
+		require.ErrorIs(t, WarmUp(ctx, p, params, "users"), context.Canceled)
+		require.Empty(t, p.opened)
+	})
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	entries := map[string]string{"user:2": "b", "user:1": "a", "session:1": "c", "use": "d"}
+
+	t.Run("scans the store", func(t *testing.T) {
+		store := &valuelessStore{Store: seededStore(t, entries)}
+		require.NoError(t, store.Put("user:untagged", []byte("e")))
+
+		keys, err := KeysWithPrefix(context.Background(), store, "user:")
+		require.NoError(t, err)
+		require.Equal(t, []string{"user:1", "user:2"}, keys)
+
+		keys, err = KeysWithPrefix(context.Background(), store, "")
+		require.NoError(t, err)
+		require.Equal(t, []string{"session:1", "use", "user:1", "user:2"}, keys)
+
+		keys, err = KeysWithPrefix(context.Background(), store, "admin:")
+		require.NoError(t, err)
+		require.Empty(t, keys)
+	})
+
+	t.Run("asks stores that list keys", func(t *testing.T) {
+		store := &prefixListingStore{Store: seededStore(t, entries), keys: []string{"user:2", "user:1"}}
+
+		keys, err := KeysWithPrefix(context.Background(), store, "user:")
+		require.NoError(t, err)
+		require.Equal(t, []string{"user:1", "user:2"}, keys)
+		require.Equal(t, []string{"user:"}, store.prefixes)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		p := NewMockProvider()
+		p.SetError("Query", errors.New("no index"))
+
+		store, err := p.OpenStore("keys")
+		require.NoError(t, err)
+
+		_, err = KeysWithPrefix(context.Background(), store, "user:")
+		require.EqualError(t, err, "list keys: unsupported operation: query entries: no index")
+		require.ErrorIs(t, err, ErrUnsupportedOperation)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := KeysWithPrefix(ctx, seededStore(t, entries), "user:")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// valuelessStore fails to read the values of its query results, for the helpers that must only read keys.
+type valuelessStore struct {
+	storage.Store
+}
+
+func (s *valuelessStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &valuelessIterator{Iterator: iterator}, nil
+}
+
+type valuelessIterator struct {
+	storage.Iterator
+}
+
+func (i *valuelessIterator) Value() ([]byte, error) {
+	return nil, errors.New("values must not be read")
+}
+
+type prefixListingStore struct {
+	storage.Store
+	keys     []string
+	prefixes []string
+}
+
+func (s *prefixListingStore) KeysWithPrefix(keyPrefix string) ([]string, error) {
+	s.prefixes = append(s.prefixes, keyPrefix)
+
+	return s.keys, nil
+}
+
+func TestWithTempStore(t *testing.T) {
+	setup := func(t *testing.T) (*mockProvider, storage.Store) {
+		t.Helper()
+
+		store, err := mem.NewProvider().OpenStore("temp")
+		require.NoError(t, err)
+
+		return &mockProvider{store: store}, store
+	}
+
+	write := func(store storage.Store) error {
+		if err := store.Put("tagged", []byte("a"), EntryTag); err != nil {
+			return err
+		}
+
+		if err := store.Put("untagged", []byte("b")); err != nil {
+			return err
+		}
+
+		return store.Batch([]storage.Operation{{Key: "batched", Value: []byte("c")}})
+	}
+
+	requireEmpty := func(t *testing.T, store storage.Store) {
+		t.Helper()
+
+		for _, key := range []string{"tagged", "untagged", "batched"} {
+			_, err := store.Get(key)
+			require.ErrorIs(t, err, storage.ErrDataNotFound, key)
+		}
+	}
+
+	t.Run("cleans up after fn", func(t *testing.T) {
+		p, backend := setup(t)
+
+		require.NoError(t, WithTempStore(context.Background(), p, func(store storage.Store) error {
+			require.NoError(t, write(store))
+
+			v, err := store.Get("untagged")
+			require.NoError(t, err)
+			require.Equal(t, []byte("b"), v)
+
+			return nil
+		}))
+
+		requireEmpty(t, backend)
+	})
+
+	t.Run("cleans up after an error", func(t *testing.T) {
+		p, backend := setup(t)
+
+		err := WithTempStore(context.Background(), p, func(store storage.Store) error {
+			require.NoError(t, write(store))
+
+			return errors.New("assertion failed")
+		})
+		require.EqualError(t, err, "assertion failed")
+
+		requireEmpty(t, backend)
+	})
+
+	t.Run("cleans up after a panic", func(t *testing.T) {
+		p, backend := setup(t)
+
+		require.PanicsWithValue(t, "boom", func() {
+			_ = WithTempStore(context.Background(), p, func(store storage.Store) error { // nolint:errcheck
+				require.NoError(t, write(store))
+
+				panic("boom")
+			})
+		})
+
+		requireEmpty(t, backend)
+	})
+
+	t.Run("unique names", func(t *testing.T) {
+		p, _ := setup(t)
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, WithTempStore(context.Background(), p, func(storage.Store) error { return nil }))
+		}
+
+		require.Len(t, p.opened, 2)
+		require.NotEqual(t, p.opened[0], p.opened[1])
+		require.True(t, strings.HasPrefix(p.opened[0], tempStorePrefix))
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		err := WithTempStore(context.Background(), &mockProvider{openErr: errors.New("offline")},
+			func(storage.Store) error {
+				require.Fail(t, "fn must not run")
+
+				return nil
+			})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "offline")
+	})
+}
+
+func TestRequireStores(t *testing.T) {
+	params := &DBParameters{URL: "mem://test", Prefix: "app"}
+
+	setup := func(t *testing.T) storage.Provider {
+		t.Helper()
+
+		p := mem.NewProvider()
+		require.NoError(t, MarkStores(p, params, "users", "sessions"))
+
+		return p
+	}
+
+	t.Run("all present", func(t *testing.T) {
+		require.NoError(t, RequireStores(context.Background(), setup(t), params, "users", "sessions"))
+	})
+
+	t.Run("some missing", func(t *testing.T) {
+		p := setup(t)
+
+		// a store with data but without its marker was not fully migrated
+		store, err := OpenPrefixedStore(p, params, "keys")
+		require.NoError(t, err)
+		require.NoError(t, store.Put("key", []byte("value"), EntryTag))
+
+		err = RequireStores(context.Background(), p, params, "users", "keys", "sessions", "tokens")
+		require.EqualError(t, err, "required stores are missing: keys, tokens")
+		require.ErrorIs(t, err, ErrStoresMissing)
+
+		require.ErrorIs(t, RequireStores(context.Background(), p, &DBParameters{Prefix: "other"}, "users"),
+			ErrStoresMissing)
+	})
+
+	t.Run("marker is not enumerable", func(t *testing.T) {
+		p := setup(t)
+
+		store, err := OpenPrefixedStore(p, params, "users")
+		require.NoError(t, err)
+
+		stats, err := StoreStats(context.Background(), store)
+		require.NoError(t, err)
+		require.Zero(t, stats.Entries)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		p := &mockProvider{store: &readRecordingStore{err: errors.New("timeout")}}
+
+		err := RequireStores(context.Background(), p, params, "users")
+		require.EqualError(t, err, "require stores: read store users: timeout")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.ErrorIs(t, RequireStores(ctx, setup(t), params, "users"), context.Canceled)
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dbEnvKeyPrefix is the prefix shared by the environment variables read by DBParams.
+const dbEnvKeyPrefix = "DATABASE_"
+
+// nolint:gochecknoglobals
+var (
+	strictEnv      bool
+	strictEnvMutex sync.RWMutex
+)
+
+// StrictEnv toggles the strict mode of DBParams, which then fails if the environment holds DATABASE_*
+// variables that are not in DescribeEnvKeys, such as misspelled ones. Aliases registered with
+// RegisterEnvAliases are known too.
+func StrictEnv(enabled bool) {
+	strictEnvMutex.Lock()
+	defer strictEnvMutex.Unlock()
+
+	strictEnv = enabled
+}
+
+func isStrictEnv() bool {
+	strictEnvMutex.RLock()
+	defer strictEnvMutex.RUnlock()
+
+	return strictEnv
+}
+
+// checkStrictEnv returns an error listing the unknown DATABASE_* variables when strict mode is enabled.
+func checkStrictEnv() error {
+	if !isStrictEnv() {
+		return nil
+	}
+
+	const keyValueParts = 2
+
+	known := DescribeEnvKeys()
+
+	for envKey := range DescribeEnvKeys() {
+		for _, alias := range AliasEnvKeys(envKey) {
+			known[alias] = ""
+		}
+	}
+
+	var unknown []string
+
+	for _, env := range os.Environ() {
+		key := strings.SplitN(env, "=", keyValueParts)[0]
+
+		if _, ok := known[key]; strings.HasPrefix(key, dbEnvKeyPrefix) && !ok {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+
+	return fmt.Errorf("unknown environment variable(s): %s", strings.Join(unknown, ", "))
+}
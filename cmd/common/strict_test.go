@@ -0,0 +1,67 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictEnv(t *testing.T) {
+	StrictEnv(true)
+	defer StrictEnv(false)
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		return cmd
+	}
+
+	t.Run("known variables", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app", Timeout: 5})
+		defer unsetEnv(t)
+
+		_, err := DBParams(newCmd())
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown prefixed variable", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+
+		require.NoError(t, os.Setenv("DATABASE_TIMEOUTS", "5"))
+		require.NoError(t, os.Setenv("DATABASE_PERFIX", "app"))
+
+		defer func() {
+			for _, key := range []string{"DATABASE_TIMEOUTS", "DATABASE_PERFIX"} {
+				require.NoError(t, os.Unsetenv(key))
+			}
+		}()
+
+		_, err := DBParams(newCmd())
+		require.EqualError(t, err, "unknown environment variable(s): DATABASE_PERFIX, DATABASE_TIMEOUTS")
+
+		StrictEnv(false)
+		defer StrictEnv(true)
+
+		_, err = DBParams(newCmd())
+		require.NoError(t, err)
+	})
+}
+
+func TestDescribeEnvKeys(t *testing.T) {
+	keys := DescribeEnvKeys()
+
+	require.Equal(t, DatabaseURLFlagUsage, keys[DatabaseURLEnvKey])
+	require.Contains(t, keys, DatabaseTimeoutEnvKey)
+	require.Contains(t, keys, DatabaseAllowClearEnvKey)
+	require.NotContains(t, keys, LogLevelEnvKey)
+}
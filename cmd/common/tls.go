@@ -0,0 +1,91 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+)
+
+// pemMarker starts inline PEM content in DBParameters.TLSCACerts.
+const pemMarker = "-----BEGIN"
+
+func readDBTLS(cmd *cobra.Command, params *DBParameters) error {
+	value := cmdutils.GetUserSetOptionalVarFromString(cmd, DatabaseTLSCACertsFlagName, DatabaseTLSCACertsEnvKey)
+
+	params.TLSCACerts = nil
+
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			params.TLSCACerts = append(params.TLSCACerts, entry)
+		}
+	}
+
+	if _, err := CACertPool(params); err != nil {
+		return fmt.Errorf("failed to configure dbTLSCACerts: %w", err)
+	}
+
+	if err := checkTLSCACerts(driverName(params), params); err != nil {
+		return fmt.Errorf("failed to configure dbTLSCACerts: %w", err)
+	}
+
+	return nil
+}
+
+// checkTLSCACerts rejects params.TLSCACerts for a driver without the TLSCACerts capability, which would
+// connect without them. Unknown drivers are left to connect to report.
+func checkTLSCACerts(driver string, params *DBParameters) error {
+	capabilities, ok := driverCapabilities[driver]
+	if len(params.TLSCACerts) > 0 && ok && !capabilities.TLSCACerts {
+		return fmt.Errorf("storage driver %s doesn't support CA certificates", driver)
+	}
+
+	return nil
+}
+
+// CACertPool returns the pool of the CA certificates in params.TLSCACerts, each entry being either inline PEM
+// content, recognized by its -----BEGIN marker, or the path of a PEM file. Escaped newlines in inline content,
+// as some environments require, are unescaped. It returns nil if no certificate is configured. Drivers with the
+// TLSCACerts capability verify the database with the pool; the certificates are rejected for the others.
+func CACertPool(params *DBParameters) (*x509.CertPool, error) {
+	if len(params.TLSCACerts) == 0 {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+
+	for _, entry := range params.TLSCACerts {
+		pemData, source, err := readPEM(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificate found in %s", source)
+		}
+	}
+
+	return pool, nil
+}
+
+func readPEM(entry string) ([]byte, string, error) {
+	if strings.Contains(entry, pemMarker) {
+		return []byte(strings.ReplaceAll(entry, `\n`, "\n")), "inline PEM", nil
+	}
+
+	pemData, err := ioutil.ReadFile(entry) // nolint:gosec
+	if err != nil {
+		return nil, "", fmt.Errorf("read CA certificate: %w", err)
+	}
+
+	return pemData, entry, nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCACertPool(t *testing.T) {
+	inline := newTestCACert(t, "inline CA")
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(path, []byte(newTestCACert(t, "file CA")), 0o600))
+
+	fileCA, err := ioutil.ReadFile(path) // nolint:gosec
+	require.NoError(t, err)
+
+	poolFor := func(t *testing.T, certs string) *x509.CertPool {
+		t.Helper()
+
+		registerTLSTestDriver(t, "tlsdb")
+		setEnv(t, &DBParameters{URL: "tlsdb://test", Prefix: "app"})
+		defer unsetEnv(t)
+		require.NoError(t, os.Setenv(DatabaseTLSCACertsEnvKey, certs))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+
+		pool, err := CACertPool(params)
+		require.NoError(t, err)
+
+		return pool
+	}
+
+	t.Run("inline PEM", func(t *testing.T) {
+		pool := poolFor(t, inline)
+		require.True(t, trusts(t, pool, inline))
+		require.False(t, trusts(t, pool, string(fileCA)))
+	})
+
+	t.Run("inline PEM with escaped newlines", func(t *testing.T) {
+		require.True(t, trusts(t, poolFor(t, strings.ReplaceAll(inline, "\n", `\n`)), inline))
+	})
+
+	t.Run("file path", func(t *testing.T) {
+		pool := poolFor(t, path)
+		require.True(t, trusts(t, pool, string(fileCA)))
+		require.False(t, trusts(t, pool, inline))
+	})
+
+	t.Run("mixed list", func(t *testing.T) {
+		pool := poolFor(t, inline+", "+path)
+		require.True(t, trusts(t, pool, inline))
+		require.True(t, trusts(t, pool, string(fileCA)))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		pool, err := CACertPool(&DBParameters{})
+		require.NoError(t, err)
+		require.Nil(t, pool)
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		_, err := CACertPool(&DBParameters{TLSCACerts: []string{filepath.Join(t.TempDir(), "missing.pem")}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "read CA certificate")
+
+		_, err = CACertPool(&DBParameters{TLSCACerts: []string{"-----BEGIN CERTIFICATE-----\ngarbage"}})
+		require.EqualError(t, err, "no certificate found in inline PEM")
+	})
+}
+
+func TestTLSCACertsCapability(t *testing.T) {
+	cert := newTestCACert(t, "db CA")
+
+	t.Run("rejected by the reader for drivers without the capability", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app"})
+		defer unsetEnv(t)
+		require.NoError(t, os.Setenv(DatabaseTLSCACertsEnvKey, cert))
+
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		_, err := DBParams(cmd)
+		require.EqualError(t, err, "failed to configure dbTLSCACerts: storage driver mem doesn't support CA certificates")
+		require.Equal(t, ErrCodeInvalidConfig, ErrorCode(err))
+
+		err = ValidateFlags(cmd)
+		require.EqualError(t, err, "failed to configure dbTLSCACerts: storage driver mem doesn't support CA certificates")
+	})
+
+	t.Run("rejected at connect for drivers without the capability", func(t *testing.T) {
+		_, err := InitEdgeStore(&DBParameters{URL: "mem://test", Timeout: 1, TLSCACerts: []string{cert}}, logger)
+		require.EqualError(t, err, "storage driver mem doesn't support CA certificates")
+		require.Equal(t, ErrCodeInvalidConfig, ErrorCode(err))
+	})
+
+	t.Run("passed to drivers with the capability", func(t *testing.T) {
+		registerTLSTestDriver(t, "tlsdb")
+		calls := recordingFactory(t, "tlsdb")
+
+		_, err := InitEdgeStore(&DBParameters{URL: "tlsdb://test", Timeout: 1, TLSCACerts: []string{cert}}, logger)
+		require.NoError(t, err)
+		require.Len(t, *calls, 1)
+
+		pool, err := CACertPool((*calls)[0].params)
+		require.NoError(t, err)
+		require.True(t, trusts(t, pool, cert))
+	})
+}
+
+// registerTLSTestDriver registers a mem driver with the TLSCACerts capability for scheme until the test
+// completes.
+func registerTLSTestDriver(t *testing.T, scheme string) {
+	t.Helper()
+
+	registerTestDriver(t, scheme, mem.NewProvider())
+
+	previous, existed := driverCapabilities[scheme]
+	driverCapabilities[scheme] = Capabilities{Query: true, TLSCACerts: true}
+
+	t.Cleanup(func() {
+		if existed {
+			driverCapabilities[scheme] = previous
+		} else {
+			delete(driverCapabilities, scheme)
+		}
+	})
+}
+
+// trusts reports whether the certificate in certPEM verifies against pool.
+func trusts(t *testing.T, pool *x509.CertPool, certPEM string) bool {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(certPEM))
+	require.NotNil(t, block)
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool})
+
+	return err == nil
+}
+
+func newTestCACert(t *testing.T, commonName string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
@@ -0,0 +1,43 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"sync"
+)
+
+// nolint:gochecknoglobals
+var (
+	dbValidators      []func(*DBParameters) error
+	dbValidatorsMutex sync.RWMutex
+)
+
+// RegisterDBValidator adds fn to the checks that DBParams and ValidateFlags run once every parameter was read,
+// so that embedding applications can enforce their own policy, such as refusing mem in production. The errors
+// of all the validators are returned together. fn is given a copy of the parameters.
+func RegisterDBValidator(fn func(*DBParameters) error) {
+	dbValidatorsMutex.Lock()
+	defer dbValidatorsMutex.Unlock()
+
+	dbValidators = append(dbValidators, fn)
+}
+
+func runDBValidators(params *DBParameters) error {
+	dbValidatorsMutex.RLock()
+	validators := append([]func(*DBParameters) error(nil), dbValidators...)
+	dbValidatorsMutex.RUnlock()
+
+	var errs multiError
+
+	for _, validate := range validators {
+		if err := validate(params.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.errorOrNil()
+}
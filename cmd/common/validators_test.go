@@ -0,0 +1,93 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterDBValidator(t *testing.T) {
+	errMemNotAllowed := errors.New("mem storage is not allowed in production")
+
+	registerTestValidators(t,
+		func(params *DBParameters) error {
+			if strings.HasPrefix(params.URL, "mem:") {
+				return errMemNotAllowed
+			}
+
+			return nil
+		},
+		func(params *DBParameters) error {
+			params.Prefix = "mutated"
+
+			if params.Timeout < 10 {
+				return errors.New("timeout too short")
+			}
+
+			return nil
+		},
+	)
+
+	t.Run("rejects mem", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app", Timeout: 30})
+		defer unsetEnv(t)
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		_, err := DBParams(cmd)
+		require.ErrorIs(t, err, errMemNotAllowed)
+		require.EqualError(t, err, "mem storage is not allowed in production")
+		require.Equal(t, ErrCodeInvalidConfig, ErrorCode(err))
+
+		require.ErrorIs(t, ValidateFlags(cmd), errMemNotAllowed)
+	})
+
+	t.Run("aggregates errors", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "mem://test", Prefix: "app", Timeout: 5})
+		defer unsetEnv(t)
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		_, err := DBParams(cmd)
+		require.EqualError(t, err, "mem storage is not allowed in production; timeout too short")
+	})
+
+	t.Run("passes and sees a copy", func(t *testing.T) {
+		setEnv(t, &DBParameters{URL: "couchdb://localhost:5984", Prefix: "app", Timeout: 30})
+		defer unsetEnv(t)
+		cmd := &cobra.Command{}
+		Flags(cmd)
+
+		params, err := DBParams(cmd)
+		require.NoError(t, err)
+		require.Equal(t, "app", params.Prefix)
+	})
+}
+
+func registerTestValidators(t *testing.T, validators ...func(*DBParameters) error) {
+	t.Helper()
+
+	dbValidatorsMutex.Lock()
+	previous := dbValidators
+	dbValidatorsMutex.Unlock()
+
+	for _, validate := range validators {
+		RegisterDBValidator(validate)
+	}
+
+	t.Cleanup(func() {
+		dbValidatorsMutex.Lock()
+		defer dbValidatorsMutex.Unlock()
+
+		dbValidators = previous
+	})
+}
@@ -0,0 +1,224 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/spf13/cobra"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// verifyStoreName is the store written to by the verify command and VerifyPrefixIsolation.
+const verifyStoreName = "dbverify"
+
+// ErrPrefixNotIsolated is returned by VerifyPrefixIsolation when an entry written under the prefix is visible
+// without it.
+var ErrPrefixNotIsolated = errors.New("prefix is not isolated")
+
+// BuildDBVerifyCommand builds a command that connects to the storage configured with the Flags, then writes,
+// reads back and deletes a sentinel key, reporting the outcome of each step. The sentinel key is removed even
+// when a later step fails.
+func BuildDBVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the database",
+		Long:  "Verify that the configured database can be written to, read from and deleted from",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := DBParams(cmd)
+			if err != nil {
+				return err
+			}
+
+			return verifyDB(cmd.OutOrStdout(), params, packageLogger())
+		},
+	}
+
+	Flags(cmd)
+
+	return cmd
+}
+
+func verifyDB(out io.Writer, params *DBParameters, logger log.Logger) error {
+	var (
+		provider storage.Provider
+		store    storage.Store
+	)
+
+	err := verifyStep(out, "connect", func() error {
+		var err error
+
+		provider, err = InitEdgeStore(params, logger)
+		if err != nil {
+			return err
+		}
+
+		store, err = provider.OpenStore(verifyStoreName)
+
+		return err
+	})
+
+	if provider != nil {
+		defer provider.Close() // nolint:errcheck
+	}
+
+	if err == nil {
+		err = verifyStore(out, store)
+	}
+
+	if err != nil {
+		return fmt.Errorf("verify database: %w", err)
+	}
+
+	return nil
+}
+
+func verifyStore(out io.Writer, store storage.Store) error {
+	key := "sentinel-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	value := []byte(key)
+
+	if err := verifyStep(out, "write", func() error { return store.Put(key, value) }); err != nil {
+		return err
+	}
+
+	deleted := false
+
+	defer func() {
+		if !deleted {
+			store.Delete(key) // nolint:errcheck
+		}
+	}()
+
+	err := verifyStep(out, "read", func() error {
+		read, err := store.Get(key)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(read, value) {
+			return fmt.Errorf("read back %q, expected %q", read, value)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	deleted = true
+
+	return verifyStep(out, "delete", func() error { return store.Delete(key) })
+}
+
+// VerifyPrefixIsolation writes a sentinel key to a store opened on p under params.Prefix with OpenPrefixedStore
+// and checks that the store of the same name opened WithoutPrefix cannot read it, returning ErrPrefixNotIsolated
+// if it can. This catches drivers that ignore the prefix. Without a prefix there is nothing to separate, so nil
+// is returned. The sentinel key is deleted before returning.
+func VerifyPrefixIsolation(ctx context.Context, p storage.Provider, params *DBParameters) error {
+	if params.Prefix == "" {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	prefixed, err := OpenPrefixedStore(p, params, verifyStoreName)
+	if err != nil {
+		return fmt.Errorf("verify prefix isolation: %w", err)
+	}
+
+	unprefixed, err := OpenPrefixedStore(p, params, verifyStoreName, WithoutPrefix())
+	if err != nil {
+		return fmt.Errorf("verify prefix isolation: %w", err)
+	}
+
+	key := "isolation-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if err = prefixed.Put(key, []byte(key)); err != nil {
+		return fmt.Errorf("verify prefix isolation: write %s: %w", key, err)
+	}
+
+	defer prefixed.Delete(key) // nolint:errcheck
+
+	_, err = unprefixed.Get(key)
+
+	switch {
+	case err == nil:
+		return fmt.Errorf("verify prefix isolation: %w: %s written under prefix %s is readable without it",
+			ErrPrefixNotIsolated, key, params.Prefix)
+	case IsNotFound(err):
+		return nil
+	default:
+		return fmt.Errorf("verify prefix isolation: read %s without prefix: %w", key, err)
+	}
+}
+
+// MeasureRoundTrip writes, reads back and deletes a sentinel key in a store opened on p with OpenPrefixedStore,
+// returning the time the cycle took, for latency dashboards. Opening the store is not measured. The sentinel key
+// is deleted even when the read fails, and MeasureRoundTrip stops between steps once ctx is done.
+func MeasureRoundTrip(ctx context.Context, p storage.Provider, params *DBParameters) (time.Duration, error) {
+	store, err := OpenPrefixedStore(p, params, verifyStoreName)
+	if err != nil {
+		return 0, fmt.Errorf("measure round trip: %w", err)
+	}
+
+	key := "roundtrip-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	started := time.Now()
+
+	if err = store.Put(key, []byte(key)); err != nil {
+		return 0, fmt.Errorf("measure round trip: write %s: %w", key, err)
+	}
+
+	deleted := false
+
+	defer func() {
+		if !deleted {
+			store.Delete(key) // nolint:errcheck
+		}
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err = store.Get(key); err != nil {
+		return 0, fmt.Errorf("measure round trip: read %s: %w", key, err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted = true
+
+	if err = store.Delete(key); err != nil {
+		return 0, fmt.Errorf("measure round trip: delete %s: %w", key, err)
+	}
+
+	return time.Since(started), nil
+}
+
+// verifyStep runs step and reports its outcome to out.
+func verifyStep(out io.Writer, name string, step func() error) error {
+	if err := step(); err != nil {
+		fmt.Fprintf(out, "%s: failed: %s\n", name, err) // nolint:errcheck
+
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	fmt.Fprintf(out, "%s: ok\n", name) // nolint:errcheck
+
+	return nil
+}
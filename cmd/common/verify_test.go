@@ -0,0 +1,179 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDBVerifyCommand(t *testing.T) {
+	run := func(t *testing.T, args ...string) (string, error) {
+		t.Helper()
+
+		var out bytes.Buffer
+
+		cmd := BuildDBVerifyCommand()
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+
+		return out.String(), err
+	}
+
+	t.Run("success against mem", func(t *testing.T) {
+		out, err := run(t, "--"+DatabaseURLFlagName, "mem://test", "--"+DatabasePrefixFlagName, "app")
+		require.NoError(t, err)
+		require.Equal(t, "connect: ok\nwrite: ok\nread: ok\ndelete: ok\n", out)
+	})
+
+	t.Run("cleans up the sentinel when a step fails", func(t *testing.T) {
+		p := mem.NewProvider()
+		store, err := p.OpenStore(verifyStoreName)
+		require.NoError(t, err)
+
+		failing := &getFailingStore{Store: store, err: errors.New("boom")}
+		registerTestDriver(t, "fake", &mockProvider{store: failing})
+
+		out, err := run(t, "--"+DatabaseURLFlagName, "fake://", "--"+DatabasePrefixFlagName, "app",
+			"--"+DatabaseTimeoutFlagName, "1")
+		require.EqualError(t, err, "verify database: read: boom")
+		require.Equal(t, "connect: ok\nwrite: ok\nread: failed: boom\n", out)
+
+		require.Len(t, failing.written, 1)
+		_, err = store.Get(failing.written[0])
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+	})
+
+	t.Run("connect failure", func(t *testing.T) {
+		registerTestDriver(t, "fake", &mockProvider{openErr: errors.New("unreachable")})
+
+		out, err := run(t, "--"+DatabaseURLFlagName, "fake://", "--"+DatabasePrefixFlagName, "app",
+			"--"+DatabaseTimeoutFlagName, "1")
+		require.EqualError(t, err, "verify database: connect: unreachable")
+		require.Equal(t, "connect: failed: unreachable\n", out)
+	})
+
+	t.Run("missing flags", func(t *testing.T) {
+		_, err := run(t)
+		require.Error(t, err)
+	})
+}
+
+// getFailingStore fails every Get and records the keys written to it.
+type getFailingStore struct {
+	storage.Store
+	err     error
+	written []string
+}
+
+func (s *getFailingStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	s.written = append(s.written, key)
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *getFailingStore) Get(string) ([]byte, error) {
+	return nil, s.err
+}
+
+func TestVerifyPrefixIsolation(t *testing.T) {
+	ctx := context.Background()
+	params := &DBParameters{URL: "mem://test", Prefix: "app"}
+
+	t.Run("isolated", func(t *testing.T) {
+		p := mem.NewProvider()
+
+		require.NoError(t, VerifyPrefixIsolation(ctx, p, params))
+
+		store, err := OpenPrefixedStore(p, params, verifyStoreName)
+		require.NoError(t, err)
+
+		empty, err := isEmpty(ctx, store)
+		require.NoError(t, err)
+		require.True(t, empty)
+	})
+
+	t.Run("leaking", func(t *testing.T) {
+		err := VerifyPrefixIsolation(ctx, &prefixIgnoringProvider{Provider: mem.NewProvider()}, params)
+		require.True(t, errors.Is(err, ErrPrefixNotIsolated))
+		require.Contains(t, err.Error(), "readable without it")
+	})
+
+	t.Run("no prefix", func(t *testing.T) {
+		p := &prefixIgnoringProvider{Provider: mem.NewProvider()}
+
+		require.NoError(t, VerifyPrefixIsolation(ctx, p, &DBParameters{URL: "mem://test"}))
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		backend, err := mem.NewProvider().OpenStore("backend")
+		require.NoError(t, err)
+
+		p := &mockProvider{store: &mockStore{Store: backend, getErr: errors.New("unavailable")}}
+
+		err = VerifyPrefixIsolation(ctx, p, params)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "without prefix: unavailable")
+	})
+}
+
+// prefixIgnoringProvider opens the same store whatever the name, like a driver that drops the prefix.
+type prefixIgnoringProvider struct {
+	*mem.Provider
+}
+
+func (p *prefixIgnoringProvider) OpenStore(string) (storage.Store, error) {
+	return p.Provider.OpenStore("shared")
+}
+
+func TestMeasureRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	params := &DBParameters{URL: "mem://test", Prefix: "app"}
+
+	t.Run("mem", func(t *testing.T) {
+		p := mem.NewProvider()
+
+		elapsed, err := MeasureRoundTrip(ctx, p, params)
+		require.NoError(t, err)
+		require.Greater(t, int64(elapsed), int64(0))
+
+		store, err := OpenPrefixedStore(p, params, verifyStoreName)
+		require.NoError(t, err)
+
+		empty, err := isEmpty(ctx, store)
+		require.NoError(t, err)
+		require.True(t, empty)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		p := NewMockProvider()
+		p.SetError("Put", errors.New("unavailable"))
+
+		_, err := MeasureRoundTrip(ctx, p, params)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unavailable")
+	})
+
+	t.Run("read error cleans up", func(t *testing.T) {
+		p := NewMockProvider()
+		p.SetError("Get", errors.New("unavailable"))
+
+		_, err := MeasureRoundTrip(ctx, p, params)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "measure round trip: read ")
+		require.Empty(t, p.Data("app_"+verifyStoreName))
+		require.Equal(t, 1, p.Calls("Delete"))
+	})
+}
@@ -25,6 +25,13 @@ PKGS=`go list github.com/trustbloc/sandbox/... 2> /dev/null | \
 go test $PKGS -count=1 -race -coverprofile=profile.out -covermode=atomic -timeout=10m
 amend_coverage_file
 
+# Running storage driver unit tests with each optional driver left out of the build
+go test ./cmd/common/... -count=1 -race -tags nomysql -timeout=10m
+go test ./cmd/common/... -count=1 -race -tags nocouchdb -timeout=10m
+
+# Running storage driver unit tests with the opt-in Cassandra driver built in
+go test ./cmd/common/... -count=1 -race -tags cassandra -timeout=10m
+
 # Running issuer-rest unit tests
 cd cmd/issuer-rest
 PKGS=`go list github.com/trustbloc/sandbox/cmd/issuer-rest/... 2> /dev/null | \